@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/gypsydave5/gobel/pkg/gobel"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+const usage = `usage: gobel <command> [arguments]
+
+The commands are:
+
+	fmt    lay out Bel source files in the canonical style
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "fmt":
+		os.Exit(fmtCommand(os.Args[2:]))
+	default:
+		fmt.Fprintf(os.Stderr, "gobel: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
+
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result back to the source file instead of stdout")
+	diff := flags.Bool("d", false, "print a diff of the changes instead of the whole result")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gobel fmt [-w] [-d] [path ...]")
+		fmt.Fprintln(os.Stderr, "\nWith no paths, fmt formats standard input. Directories are searched for .bel files.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "gobel fmt: cannot use -w with standard input")
+			return 2
+		}
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := formatFile("<stdin>", src, false, *diff); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	// a file that can't be read or formatted is reported, and the rest are
+	// still formatted
+	status := 0
+	report := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		status = 1
+	}
+	for _, root := range flags.Args() {
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				report(err)
+				return nil
+			}
+			// files named on the command line are formatted whatever they're called
+			if info.IsDir() || (path != root && filepath.Ext(path) != ".bel") {
+				return nil
+			}
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				report(err)
+				return nil
+			}
+			if err := formatFile(path, src, *write, *diff); err != nil {
+				report(err)
+			}
+			return nil
+		})
+	}
+	return status
+}
+
+func formatFile(path string, src []byte, write, diff bool) error {
+	out, err := gobel.Format(path, src)
+	if err != nil {
+		return err
+	}
+
+	if diff {
+		d, err := diffFile(path, src, out)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(d)
+	}
+	if write {
+		if bytes.Equal(src, out) {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, out, info.Mode().Perm())
+	}
+	if !diff {
+		os.Stdout.Write(out)
+	}
+	return nil
+}
+
+// diffFile runs diff -u on the old and new versions of a file, the way gofmt -d
+// used to.
+func diffFile(path string, old, new []byte) ([]byte, error) {
+	if bytes.Equal(old, new) {
+		return nil, nil
+	}
+	dir, err := ioutil.TempDir("", "gobel-fmt")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	oldFile, newFile := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+	if err := ioutil.WriteFile(oldFile, old, 0600); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(newFile, new, 0600); err != nil {
+		return nil, err
+	}
+
+	d, err := exec.Command("diff", "-u", "--label", path+".orig", "--label", path, oldFile, newFile).Output()
+	if len(d) > 0 {
+		// diff exits with status 1 when the files differ
+		return d, nil
+	}
+	return nil, err
+}
@@ -1,42 +1,81 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"github.com/gypsydave5/gobel/pkg/gobel"
 	"io"
-	"io/ioutil"
 	"os"
 )
 
 func main() {
 	if isPipe(os.Stdin) {
-		c, _ := ioutil.ReadAll(os.Stdin)
-		result := gobel.Eval(gobel.Read(string(c)), gobel.GlobalEnv())
+		reader, env := stdinEnv()
+
+		var result gobel.Value
+		for {
+			expression, err := reader.ReadExpr()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			result, err = gobel.Eval([]gobel.Value{expression}, env)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, describe(err))
+				os.Exit(1)
+			}
+		}
 		fmt.Println(result)
 	} else {
 		repl()
 	}
 }
 
+// stdinEnv returns a global environment, and a reader for the expressions on
+// standard input. Bel code reading from standard input with read reads from the
+// same place, so it gets the input that follows the expression it's in.
+func stdinEnv() (*gobel.Reader, *gobel.Env) {
+	stdin := gobel.NewInStream(os.Stdin)
+	env := gobel.GlobalEnvWithStreams(stdin, gobel.NewOutStream(os.Stdout))
+	reader := stdin.Reader()
+	reader.Filename = "<stdin>"
+	return reader, env
+}
+
 func repl() {
-	reader := bufio.NewReader(os.Stdin)
-	env := gobel.GlobalEnv()
+	reader, env := stdinEnv()
 
 	for {
 		fmt.Print("> ")
-		expression, err := reader.ReadString('\n')
+		expression, err := reader.ReadExpr()
 		if err == io.EOF {
 			break
 		}
-		ts := gobel.Read(expression)
-		result := gobel.Eval(ts, env)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		result, err := gobel.Eval([]gobel.Value{expression}, env)
+		if err != nil {
+			fmt.Println(describe(err))
+			continue
+		}
 		fmt.Println(result)
 	}
 
 	fmt.Println("\nHave a nice day!")
 }
 
+// describe gives the stack trace of errors raised by Bel code.
+func describe(err error) string {
+	if e, ok := err.(*gobel.BelError); ok {
+		return e.StackTrace()
+	}
+	return err.Error()
+}
+
 func isPipe(f *os.File) bool {
 	fi, _ := f.Stat()
 	return (fi.Mode() & os.ModeCharDevice) == 0
@@ -1,3 +1,3 @@
 module github.com/gypsydave5/gobel
 
-go 1.14
+go 1.16
@@ -0,0 +1,309 @@
+package gobel
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"text/scanner"
+	"unicode"
+)
+
+// TokenKind says what sort of token a BelLexer has found.
+type TokenKind int
+
+const (
+	TokenEOF TokenKind = iota
+	// TokenOpen is ( or [, or a { for a read macro to use.
+	TokenOpen
+	// TokenClose is ) or ], or a }.
+	TokenClose
+	// TokenDot is a . on its own, as found in a dotted list.
+	TokenDot
+	// TokenPrefix is one of ' ` , ,@ or #;, which apply to the expression
+	// after them.
+	TokenPrefix
+	// TokenLabel is a datum label, #n= or #n#.
+	TokenLabel
+	TokenSymbol
+	TokenNumber
+	TokenChar
+	TokenString
+	// TokenComment is a line or block comment, which the lexer only returns
+	// if its Comments field is set.
+	TokenComment
+)
+
+var tokenKindNames = [...]string{"EOF", "open", "close", "dot", "prefix", "label", "symbol", "number", "char", "string", "comment"}
+
+func (k TokenKind) String() string {
+	return tokenKindNames[k]
+}
+
+// Token is a single token of Bel source: what kind of token it is, how it was
+// written and where it starts.
+type Token struct {
+	Kind TokenKind
+	Text string
+	Pos  scanner.Position
+}
+
+// BelLexer lexes a Bel program following Bel's own rules for what makes up a
+// token. Anything that isn't whitespace or one of ()[]{}";'`, is part of a word,
+// so <=, *foo* and no? are all symbols.
+//
+// Like ScanLexer it reads lazily, so it never waits on input it doesn't need.
+type BelLexer struct {
+	// Comments makes the lexer return comments as tokens, rather than
+	// skipping them along with whitespace.
+	Comments bool
+
+	in      *bufio.Reader
+	pos     scanner.Position // where the next rune starts
+	tok     Token
+	err     error
+	pending bool
+}
+
+func NewBelLexer(r io.Reader) *BelLexer {
+	return &BelLexer{
+		in:      bufio.NewReader(r),
+		pos:     scanner.Position{Line: 1, Column: 1},
+		pending: true,
+	}
+}
+
+func (l *BelLexer) Current() string {
+	l.fill()
+	return l.tok.Text
+}
+
+func (l *BelLexer) Next() {
+	l.fill()
+	l.pending = true
+}
+
+func (l *BelLexer) End() bool {
+	l.fill()
+	return l.tok.Kind == TokenEOF
+}
+
+// Pos returns the position of the start of the current token.
+func (l *BelLexer) Pos() scanner.Position {
+	l.fill()
+	return l.tok.Pos
+}
+
+// Err returns the error, if any, found while reading the current token.
+func (l *BelLexer) Err() error {
+	l.fill()
+	return l.err
+}
+
+// Token returns the current token.
+func (l *BelLexer) Token() Token {
+	l.fill()
+	return l.tok
+}
+
+func (l *BelLexer) peek() rune {
+	r, _, err := l.in.ReadRune()
+	if err != nil {
+		return scanner.EOF
+	}
+	l.in.UnreadRune()
+	return r
+}
+
+// peekString reports whether the input carries on with s.
+func (l *BelLexer) peekString(s string) bool {
+	b, _ := l.in.Peek(len(s))
+	return string(b) == s
+}
+
+func (l *BelLexer) next() rune {
+	r, size, err := l.in.ReadRune()
+	if err != nil {
+		return scanner.EOF
+	}
+	l.pos.Offset += size
+	if r == '\n' {
+		l.pos.Line++
+		l.pos.Column = 1
+	} else {
+		l.pos.Column++
+	}
+	return r
+}
+
+func (l *BelLexer) fill() {
+	if !l.pending {
+		return
+	}
+	l.pending = false
+	l.err = nil
+	if !l.skipSpace() {
+		return
+	}
+
+	var text strings.Builder
+	l.tok = Token{Pos: l.pos}
+	defer func() { l.tok.Text = text.String() }()
+
+	// skipSpace only stops at a comment if it's to be returned as a token
+	switch {
+	case l.peek() == ';':
+		l.tok.Kind = TokenComment
+		l.readLine(&text)
+		return
+	case l.peekString("#|"):
+		l.tok.Kind = TokenComment
+		if !l.readBlock(&text) {
+			l.err = errors.New("comment not terminated")
+		}
+		return
+	}
+
+	r := l.next()
+	if r == scanner.EOF {
+		l.tok.Kind = TokenEOF
+		return
+	}
+	text.WriteRune(r)
+
+	switch {
+	case r == '(' || r == '[' || r == '{':
+		l.tok.Kind = TokenOpen
+	case r == ')' || r == ']' || r == '}':
+		l.tok.Kind = TokenClose
+	case r == '\'' || r == '`':
+		l.tok.Kind = TokenPrefix
+	case r == ',':
+		if l.peek() == '@' {
+			text.WriteRune(l.next())
+		}
+		l.tok.Kind = TokenPrefix
+	case r == '"':
+		l.tok.Kind = TokenString
+		l.readString(&text)
+	case r == '\\':
+		l.tok.Kind = TokenChar
+		switch next := l.peek(); {
+		case next == scanner.EOF:
+			l.err = errors.New("missing character after \\")
+		case isDelimiter(next):
+			text.WriteRune(l.next())
+		default:
+			l.readWord(&text)
+		}
+	case r == '#' && l.peek() == ';':
+		text.WriteRune(l.next())
+		l.tok.Kind = TokenPrefix
+	case r == '#' && isDigits(string(l.peek())):
+		for isDigits(string(l.peek())) {
+			text.WriteRune(l.next())
+		}
+		if next := l.peek(); next == '=' || next == '#' {
+			text.WriteRune(l.next())
+		}
+		l.tok.Kind = TokenLabel
+	default:
+		l.readWord(&text)
+		word := text.String()
+		if word == "." {
+			l.tok.Kind = TokenDot
+		} else if _, ok, _ := parseNumber(word); ok {
+			l.tok.Kind = TokenNumber
+		} else {
+			l.tok.Kind = TokenSymbol
+		}
+	}
+}
+
+// skipSpace skips whitespace, and comments unless they are to be returned as
+// tokens. An unterminated block comment is left as the current token, with an
+// error, and skipSpace reports false.
+func (l *BelLexer) skipSpace() bool {
+	var comment strings.Builder
+	for {
+		r := l.peek()
+		switch {
+		case unicode.IsSpace(r):
+			l.next()
+		case r == ';' && !l.Comments:
+			l.readLine(&comment)
+		case r == '#' && l.peekString("#|") && !l.Comments:
+			pos := l.pos
+			if !l.readBlock(&comment) {
+				l.err = errors.New("comment not terminated")
+				l.tok = Token{Kind: TokenSymbol, Text: "#|", Pos: pos}
+				return false
+			}
+		default:
+			return true
+		}
+		comment.Reset()
+	}
+}
+
+// readLine reads a ; comment, up to the end of the line.
+func (l *BelLexer) readLine(text *strings.Builder) {
+	for r := l.peek(); r != '\n' && r != scanner.EOF; r = l.peek() {
+		text.WriteRune(l.next())
+	}
+}
+
+// readBlock reads a #| ... |# comment, which can have other block comments
+// nested inside it. It reports whether it found the end of the comment.
+func (l *BelLexer) readBlock(text *strings.Builder) bool {
+	text.WriteRune(l.next())
+	text.WriteRune(l.next())
+	for depth := 1; depth > 0; {
+		switch {
+		case l.peekString("#|"):
+			depth++
+		case l.peekString("|#"):
+			depth--
+		default:
+			r := l.next()
+			if r == scanner.EOF {
+				return false
+			}
+			text.WriteRune(r)
+			continue
+		}
+		text.WriteRune(l.next())
+		text.WriteRune(l.next())
+	}
+	return true
+}
+
+// isDelimiter reports whether r ends a word.
+func isDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("()[]{}\";'`,", r)
+}
+
+func (l *BelLexer) readWord(text *strings.Builder) {
+	for r := l.peek(); r != scanner.EOF && !isDelimiter(r); r = l.peek() {
+		text.WriteRune(l.next())
+	}
+}
+
+func (l *BelLexer) readString(text *strings.Builder) {
+	for {
+		r := l.next()
+		if r == scanner.EOF {
+			l.err = errors.New("literal not terminated")
+			return
+		}
+		text.WriteRune(r)
+		if r == '"' {
+			return
+		}
+		if r == '\\' {
+			if escaped := l.next(); escaped != scanner.EOF {
+				text.WriteRune(escaped)
+			}
+		}
+	}
+}
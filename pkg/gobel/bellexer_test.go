@@ -0,0 +1,142 @@
+package gobel
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"text/scanner"
+)
+
+func TestBelLexer(t *testing.T) {
+	cases := []struct {
+		name    string
+		program string
+		want    []Token
+	}{
+		{"simple", "(+ 1 1)", []Token{
+			{Kind: TokenOpen, Text: "("}, {Kind: TokenSymbol, Text: "+"}, {Kind: TokenNumber, Text: "1"},
+			{Kind: TokenNumber, Text: "1"}, {Kind: TokenClose, Text: ")"}}},
+		{"comparison", "(<= a b)", []Token{
+			{Kind: TokenOpen, Text: "("}, {Kind: TokenSymbol, Text: "<="}, {Kind: TokenSymbol, Text: "a"},
+			{Kind: TokenSymbol, Text: "b"}, {Kind: TokenClose, Text: ")"}}},
+		{"earmuffs", "*foo*", []Token{{Kind: TokenSymbol, Text: "*foo*"}}},
+		{"predicate", "no?", []Token{{Kind: TokenSymbol, Text: "no?"}}},
+		{"symbol starting with a digit", "1+", []Token{{Kind: TokenSymbol, Text: "1+"}}},
+		{"numbers", "-1 3/4 +2", []Token{
+			{Kind: TokenNumber, Text: "-1"}, {Kind: TokenNumber, Text: "3/4"}, {Kind: TokenNumber, Text: "+2"}}},
+		{"intrasymbol", "a.b x|int ~f:g", []Token{
+			{Kind: TokenSymbol, Text: "a.b"}, {Kind: TokenSymbol, Text: "x|int"}, {Kind: TokenSymbol, Text: "~f:g"}}},
+		{"dotted list", "(a . b)", []Token{
+			{Kind: TokenOpen, Text: "("}, {Kind: TokenSymbol, Text: "a"}, {Kind: TokenDot, Text: "."},
+			{Kind: TokenSymbol, Text: "b"}, {Kind: TokenClose, Text: ")"}}},
+		{"characters", `\a \bel \( \; \"`, []Token{
+			{Kind: TokenChar, Text: `\a`}, {Kind: TokenChar, Text: `\bel`}, {Kind: TokenChar, Text: `\(`},
+			{Kind: TokenChar, Text: `\;`}, {Kind: TokenChar, Text: `\"`}}},
+		{"character before a close", `(\a)`, []Token{
+			{Kind: TokenOpen, Text: "("}, {Kind: TokenChar, Text: `\a`}, {Kind: TokenClose, Text: ")"}}},
+		{"string", `"a \"b\" c"`, []Token{{Kind: TokenString, Text: `"a \"b\" c"`}}},
+		{"quotes", "'a `(,b ,@c)", []Token{
+			{Kind: TokenPrefix, Text: "'"}, {Kind: TokenSymbol, Text: "a"}, {Kind: TokenPrefix, Text: "`"},
+			{Kind: TokenOpen, Text: "("}, {Kind: TokenPrefix, Text: ","}, {Kind: TokenSymbol, Text: "b"},
+			{Kind: TokenPrefix, Text: ",@"}, {Kind: TokenSymbol, Text: "c"}, {Kind: TokenClose, Text: ")"}}},
+		{"quote sticks to the right thing", "a'b", []Token{
+			{Kind: TokenSymbol, Text: "a"}, {Kind: TokenPrefix, Text: "'"}, {Kind: TokenSymbol, Text: "b"}}},
+		{"labels", "#1=(#1#)", []Token{
+			{Kind: TokenLabel, Text: "#1="}, {Kind: TokenOpen, Text: "("}, {Kind: TokenLabel, Text: "#1#"},
+			{Kind: TokenClose, Text: ")"}}},
+		{"comments", "a ; b\n#| c #| d |# |# #;e", []Token{
+			{Kind: TokenSymbol, Text: "a"}, {Kind: TokenPrefix, Text: "#;"}, {Kind: TokenSymbol, Text: "e"}}},
+		{"brackets", "[f _]", []Token{
+			{Kind: TokenOpen, Text: "["}, {Kind: TokenSymbol, Text: "f"}, {Kind: TokenSymbol, Text: "_"},
+			{Kind: TokenClose, Text: "]"}}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := NewBelLexer(strings.NewReader(c.program))
+			var tokens []Token
+			for ; !l.End(); l.Next() {
+				tok := l.Token()
+				tok.Pos = l.Pos()
+				tok.Pos.Line, tok.Pos.Column, tok.Pos.Offset = 0, 0, 0
+				tokens = append(tokens, tok)
+			}
+			if !reflect.DeepEqual(tokens, c.want) {
+				t.Errorf("wanted %v but got %v", c.want, tokens)
+			}
+		})
+	}
+
+	t.Run("comments as tokens", func(t *testing.T) {
+		l := NewBelLexer(strings.NewReader("a ; b\n#| c #| d |# |# #;e"))
+		l.Comments = true
+		var tokens []Token
+		for ; !l.End(); l.Next() {
+			tok := l.Token()
+			tok.Pos = scanner.Position{}
+			tokens = append(tokens, tok)
+		}
+		want := []Token{
+			{Kind: TokenSymbol, Text: "a"}, {Kind: TokenComment, Text: "; b"}, {Kind: TokenComment, Text: "#| c #| d |# |#"},
+			{Kind: TokenPrefix, Text: "#;"}, {Kind: TokenSymbol, Text: "e"}}
+		if !reflect.DeepEqual(tokens, want) {
+			t.Errorf("wanted %v but got %v", want, tokens)
+		}
+	})
+
+	t.Run("positions", func(t *testing.T) {
+		l := NewBelLexer(strings.NewReader("(a\n  bé c)"))
+		want := [][2]int{{1, 1}, {1, 2}, {2, 3}, {2, 6}, {2, 7}}
+		for i := 0; !l.End(); l.Next() {
+			if pos := l.Pos(); pos.Line != want[i][0] || pos.Column != want[i][1] {
+				t.Errorf("Expected %q at %d:%d but got %s", l.Current(), want[i][0], want[i][1], pos)
+			}
+			i++
+		}
+	})
+}
+
+// TestLexersAgree reads the same programs with a ScanLexer and a BelLexer, to
+// check that they see them the same way.
+func TestLexersAgree(t *testing.T) {
+	programs := []string{
+		"(+ 1 2)",
+		"(define double (x) (+ x x)) (double 4)",
+		"'(a . b) `(a ,b ,@c)",
+		`(\a \bel \sp "hello \"there\"")`,
+		"[f _ (g _)] (a.b x|int ~f:g c!d)",
+		"(1/2 -3 123456789012345678901234567890)",
+		"#1=(a #1#) (#2=(b) #2#)",
+		"; comment\n(a #| block |# b #;c)",
+	}
+	for _, p := range programs {
+		t.Run(p, func(t *testing.T) {
+			scanned, err := readAll(NewLexerReader(NewScanLexer(strings.NewReader(p))))
+			if err != nil {
+				t.Fatalf("Unexpected error reading with ScanLexer: %v", err)
+			}
+			lexed, err := readAll(NewLexerReader(NewBelLexer(strings.NewReader(p))))
+			if err != nil {
+				t.Fatalf("Unexpected error reading with BelLexer: %v", err)
+			}
+			if a, b := listOf(scanned...).String(), listOf(lexed...).String(); a != b {
+				t.Errorf("ScanLexer read %s but BelLexer read %s", a, b)
+			}
+		})
+	}
+}
+
+func readAll(r *Reader) ([]Value, error) {
+	var exprs []Value
+	for {
+		e, err := r.ReadExpr()
+		if err == io.EOF {
+			return exprs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+	}
+}
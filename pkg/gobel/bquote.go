@@ -0,0 +1,202 @@
+package gobel
+
+// bquote evaluates a backquoted template. The template is first expanded into
+// code that builds it, following the definition of bquote in the Bel source,
+// and then that code is evaluated in env.
+func bquote(m *machine, l *Pair, env *Env) error {
+	code, changed := bqex(car(l), 0)
+	if !changed {
+		m.ret(car(l))
+		return nil
+	}
+	if _, ok := code.(splice); ok {
+		return belErrorf(OtherError, "comma-at outside a list")
+	}
+	m.evalTail(code, env)
+	return nil
+}
+
+// splice marks an expression whose value is to be spliced into the list
+// around it.
+type splice struct {
+	expression Value
+}
+
+// splice is only ever seen by the expander, but it's carried around as a Value.
+func (splice) isValue()         {}
+func (splice) Type() *Symbol    { return Intern("splice") }
+func (s splice) String() string { return ",@" + toString(s.expression) }
+
+// bqex expands e, a template nested n backquotes deep inside the outermost one.
+// It reports whether it found anything to evaluate: if not the template can be
+// used as it is.
+func bqex(e Value, n int) (Value, bool) {
+	p, ok := e.(*Pair)
+	if !ok || p == Nil {
+		return quoted(e), false
+	}
+	switch operator(p) {
+	case "bquote":
+		return bqthru(p, n+1, "bquote")
+	case "comma":
+		if n == 0 {
+			return cadr(p), true
+		}
+		return bqthru(p, n-1, "comma")
+	case "comma-at":
+		if n == 0 {
+			return splice{cadr(p)}, true
+		}
+		return bqthru(p, n-1, "comma-at")
+	}
+	return bqexpair(p, n)
+}
+
+// bqthru expands the template inside a nested bquote, comma or comma-at,
+// keeping the operator around it.
+func bqthru(e *Pair, n int, op string) (Value, bool) {
+	sub, changed := bqex(cadr(e), n)
+	if !changed {
+		return quoted(e), false
+	}
+	if s, ok := sub.(splice); ok {
+		return listOf(bqCons, quoted(Intern(op)), s.expression), true
+	}
+	return listOf(bqList, quoted(Intern(op)), sub), true
+}
+
+func bqexpair(e *Pair, n int) (Value, bool) {
+	a, achanged := bqex(e.First, n)
+	d, dchanged := bqex(e.Rest, n)
+	if !achanged && !dchanged {
+		return quoted(e), false
+	}
+	as, aspliced := a.(splice)
+	ds, dspliced := d.(splice)
+	switch {
+	case aspliced && dspliced:
+		return listOf(bqAppendAll, as.expression, ds.expression), true
+	case dspliced:
+		return listOf(bqConsAll, a, ds.expression), true
+	case aspliced:
+		return listOf(bqAppend, as.expression, d), true
+	}
+	return listOf(bqCons, a, d), true
+}
+
+// operator returns the name of the symbol at the head of a two element list,
+// or nothing if p doesn't look like (op x).
+func operator(p *Pair) string {
+	s, ok := p.First.(*Symbol)
+	if !ok {
+		return ""
+	}
+	rest, ok := p.Rest.(*Pair)
+	if !ok || rest == Nil || !isNil(rest.Rest) {
+		return ""
+	}
+	return s.name
+}
+
+func quoted(e Value) *Pair {
+	return listOf(&SpecialForm{form: quote}, e)
+}
+
+func listOf(items ...Value) *Pair {
+	p := Nil
+	for i := len(items) - 1; i >= 0; i-- {
+		p = cons(items[i], p)
+	}
+	return p
+}
+
+func cadr(p *Pair) Value {
+	return car(cdrPair(p))
+}
+
+// The procedures used by expanded templates are referred to directly, rather
+// than by name, so that rebinding list or cons doesn't change what a
+// template means.
+var (
+	bqCons = &NativeProcedure{application: func(args *Pair) (Value, error) {
+		return cons(car(args), cadr(args)), nil
+	}}
+
+	bqList = &NativeProcedure{application: func(args *Pair) (Value, error) {
+		return args, nil
+	}}
+
+	// bqAppend copies its first argument, a spliced list, onto the second.
+	bqAppend = &NativeProcedure{application: func(args *Pair) (Value, error) {
+		return spliceOnto(car(args), cadr(args))
+	}}
+
+	// bqConsAll conses its first argument onto the spliced list that follows
+	// it, with the last element of that list becoming the tail.
+	bqConsAll = &NativeProcedure{application: func(args *Pair) (Value, error) {
+		xs, ok := cadr(args).(*Pair)
+		if !ok {
+			return nil, belErrorf(TypeError, "cannot splice an atom")
+		}
+		items := []Value{car(args)}
+		for ; xs != Nil; xs = cdrPair(xs) {
+			items = append(items, xs.First)
+			if _, ok := xs.Rest.(*Pair); !ok {
+				return nil, belErrorf(TypeError, "cannot splice a dotted list")
+			}
+		}
+		result := items[len(items)-1]
+		for i := len(items) - 2; i >= 0; i-- {
+			result = cons(items[i], result)
+		}
+		return result, nil
+	}}
+
+	// bqAppendAll splices its first argument onto every list in its second, a
+	// spliced list of lists.
+	bqAppendAll = &NativeProcedure{application: func(args *Pair) (Value, error) {
+		xs, ok := cadr(args).(*Pair)
+		if !ok {
+			return nil, belErrorf(TypeError, "cannot splice an atom")
+		}
+		var lists []Value
+		for ; xs != Nil; xs = cdrPair(xs) {
+			lists = append(lists, xs.First)
+		}
+		if len(lists) == 0 {
+			return car(args), nil
+		}
+		result := lists[len(lists)-1]
+		for i := len(lists) - 2; i >= 0; i-- {
+			var err error
+			if result, err = spliceOnto(lists[i], result); err != nil {
+				return nil, err
+			}
+		}
+		return spliceOnto(car(args), result)
+	}}
+)
+
+func spliceOnto(xs, tail Value) (Value, error) {
+	p, ok := xs.(*Pair)
+	if !ok {
+		return nil, belErrorf(TypeError, "cannot splice an atom")
+	}
+	var items []Value
+	for ; p != Nil; p = cdrPair(p) {
+		items = append(items, p.First)
+	}
+	for i := len(items) - 1; i >= 0; i-- {
+		tail = cons(items[i], tail)
+	}
+	return tail, nil
+}
+
+// cdrPair is the rest of p, or the end of the list if p is dotted.
+func cdrPair(p *Pair) *Pair {
+	if p == Nil {
+		return Nil
+	}
+	rest, _ := p.Rest.(*Pair)
+	return rest
+}
@@ -0,0 +1,77 @@
+package gobel
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// charNames maps the names Bel gives to characters onto the characters
+// themselves. Every control character has a name, taken from ASCII.
+var charNames = map[string]rune{
+	"nul": 0x00, "soh": 0x01, "stx": 0x02, "etx": 0x03,
+	"eot": 0x04, "enq": 0x05, "ack": 0x06, "bel": 0x07,
+	"bs": 0x08, "tab": 0x09, "lf": 0x0a, "vt": 0x0b,
+	"ff": 0x0c, "cr": 0x0d, "so": 0x0e, "si": 0x0f,
+	"dle": 0x10, "dc1": 0x11, "dc2": 0x12, "dc3": 0x13,
+	"dc4": 0x14, "nak": 0x15, "syn": 0x16, "etb": 0x17,
+	"can": 0x18, "em": 0x19, "sub": 0x1a, "esc": 0x1b,
+	"fs": 0x1c, "gs": 0x1d, "rs": 0x1e, "us": 0x1f,
+	"sp": ' ', "del": 0x7f,
+}
+
+// charAliases are names the reader accepts but the printer never uses.
+var charAliases = map[string]rune{
+	"space": ' ',
+}
+
+// nameOfChar is the inverse of charNames, used when printing.
+var nameOfChar = func() map[rune]string {
+	names := make(map[rune]string, len(charNames))
+	for name, r := range charNames {
+		names[r] = name
+	}
+	return names
+}()
+
+// charCodeLookup finds the character written as \s. It can be a single
+// character, one of the names in charNames, or a Unicode escape written
+// \uXXXX or \UXXXXXXXX.
+func charCodeLookup(s string) (rune, error) {
+	if utf8.RuneCountInString(s) == 1 {
+		// length is 1 so assume this is a direct mapping of rune to rune
+		r, _ := utf8.DecodeRuneInString(s)
+		return r, nil
+	}
+
+	if r, ok := charNames[s]; ok {
+		return r, nil
+	}
+	if r, ok := charAliases[s]; ok {
+		return r, nil
+	}
+
+	if (s[0] == 'u' && len(s) == 5) || (s[0] == 'U' && len(s) == 9) {
+		code, err := strconv.ParseUint(s[1:], 16, 32)
+		if err == nil && utf8.ValidRune(rune(code)) {
+			return rune(code), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown character \\%s", s)
+}
+
+// charString prints r so that the reader will read it back as r.
+func charString(r rune) string {
+	if name, ok := nameOfChar[r]; ok {
+		return `\` + name
+	}
+	if unicode.IsPrint(r) {
+		return `\` + string(r)
+	}
+	if r > 0xffff {
+		return fmt.Sprintf(`\U%08x`, r)
+	}
+	return fmt.Sprintf(`\u%04x`, r)
+}
@@ -0,0 +1,452 @@
+package gobel
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Define binds name in env to the Go function fn, so that Bel can call it.
+// Arguments are converted from Bel to the types fn takes, and its result is
+// converted back:
+//
+//   - integer and floating-point types are numbers
+//   - a string is a Bel string
+//   - a bool is false for nil and true for anything else, and t or nil on the
+//     way back
+//   - a slice is a list
+//   - a map is a table, or an association list on the way in
+//   - a function is a Bel function
+//   - a struct is an association list, as Marshal makes, and a pointer is
+//     what it points to, or nil
+//   - Value, and the types that implement it, are passed as they are
+//
+// fn may return nothing, a value, an error, or a value and an error. A non-nil
+// error is returned to Bel as a *BelError, and so is calling fn with the wrong
+// number of arguments or with arguments that won't convert. Define panics if
+// fn isn't a function it can call.
+func (env *Env) Define(name string, fn interface{}) {
+	v := reflect.ValueOf(fn)
+	if err := checkFunc(v.Type()); err != nil {
+		panic(fmt.Sprintf("gobel: Define %s: %v", name, err))
+	}
+	env.set(name, goFunction(name, v))
+}
+
+// checkFunc reports why Define can't call functions of type t, if it can't.
+func checkFunc(t reflect.Type) error {
+	if t.Kind() != reflect.Func {
+		return fmt.Errorf("%s is not a function", t)
+	}
+	if n := t.NumOut(); n > 2 || (n == 2 && t.Out(1) != errorType) {
+		return fmt.Errorf("%s returns more than a value and an error", t)
+	}
+	return nil
+}
+
+// goFunction makes a NativeProcedure that calls fn.
+func goFunction(name string, fn reflect.Value) *NativeProcedure {
+	t := fn.Type()
+	return &NativeProcedure{step: func(m *machine, l *Pair) (err error) {
+		// Bel functions that fn was given report their errors, and the
+		// continuations they call, by panicking, as there may be no other
+		// way out of fn
+		defer func() {
+			switch r := recover().(type) {
+			case nil:
+			case *BelError:
+				err = r
+			case *jump:
+				err = r
+			default:
+				panic(r)
+			}
+		}()
+		args, argErr := goArgs(m, name, t, l)
+		if argErr != nil {
+			return argErr
+		}
+		result, err := goResults(fn.Call(args))
+		if err != nil {
+			return err
+		}
+		m.ret(result)
+		return nil
+	}}
+}
+
+// goArgs converts the arguments in l to the ones a function of type t takes.
+// Bel functions among them are converted to Go functions that run on machines
+// inside caller.
+func goArgs(caller *machine, name string, t reflect.Type, l *Pair) ([]reflect.Value, *BelError) {
+	n := t.NumIn()
+	if t.IsVariadic() {
+		n--
+	}
+	var args []reflect.Value
+	for i := 0; l != Nil; i, l = i+1, cdrPair(l) {
+		var argType reflect.Type
+		switch {
+		case i < n:
+			argType = t.In(i)
+		case t.IsVariadic():
+			argType = t.In(n).Elem()
+		default:
+			return nil, belErrorf(ArityError, "overargs: too many arguments to %s", name)
+		}
+		arg, err := toGo(caller, l.First, argType)
+		if err != nil {
+			return nil, belErrorf(TypeError, "%s: %v", name, err)
+		}
+		args = append(args, arg)
+	}
+	if len(args) < n {
+		return nil, belErrorf(ArityError, "underargs: too few arguments to %s", name)
+	}
+	return args, nil
+}
+
+// goResults converts what a Go function returned to a Bel value.
+func goResults(out []reflect.Value) (Value, error) {
+	if n := len(out); n > 0 && out[n-1].Type() == errorType {
+		if err := out[n-1].Interface(); err != nil {
+			return nil, belError(err.(error))
+		}
+		out = out[:n-1]
+	}
+	if len(out) == 0 {
+		return Nil, nil
+	}
+	v, err := fromGo(out[0])
+	if err != nil {
+		return nil, belError(err)
+	}
+	return v, nil
+}
+
+// toGo converts v to a Go value of type t.
+func toGo(caller *machine, v Value, t reflect.Type) (reflect.Value, error) {
+	dst := reflect.New(t).Elem()
+	return dst, setGo(caller, dst, v)
+}
+
+// setGo converts v to the type of dst and stores it there. Structs, and what
+// pointers point to, are filled in rather than replaced, so that fields v says
+// nothing about keep the values they had. Bel functions become Go functions
+// that run on machines inside caller, which is nil if there's no Bel running.
+func setGo(caller *machine, dst reflect.Value, v Value) error {
+	t := dst.Type()
+	if v != nil && reflect.TypeOf(v).AssignableTo(t) {
+		dst.Set(reflect.ValueOf(v))
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := goInt(v)
+		if !ok || dst.OverflowInt(n) {
+			return fmt.Errorf("%s is not an integer that fits in %s", toString(v), t)
+		}
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := goUint(v)
+		if !ok || dst.OverflowUint(n) {
+			return fmt.Errorf("%s is not an integer that fits in %s", toString(v), t)
+		}
+		dst.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFloat(v)
+		if !ok {
+			return fmt.Errorf("%s is not a number", toString(v))
+		}
+		dst.SetFloat(f)
+	case reflect.String:
+		s, ok := goString(v)
+		if !ok {
+			return fmt.Errorf("%s is not a string", toString(v))
+		}
+		dst.SetString(s)
+	case reflect.Bool:
+		dst.SetBool(!isNil(v))
+	case reflect.Slice:
+		l, ok := properList(v)
+		if !ok {
+			return fmt.Errorf("%s is not a list", toString(v))
+		}
+		s := reflect.MakeSlice(t, 0, 0)
+		for ; l != Nil; l = cdrPair(l) {
+			e, err := toGo(caller, l.First, t.Elem())
+			if err != nil {
+				return err
+			}
+			s = reflect.Append(s, e)
+		}
+		dst.Set(s)
+	case reflect.Map:
+		m, err := toGoMap(caller, v, t)
+		if err != nil {
+			return err
+		}
+		dst.Set(m)
+	case reflect.Func:
+		if err := checkFunc(t); err != nil {
+			return err
+		}
+		dst.Set(belFunction(caller, v, t))
+	case reflect.Ptr:
+		if isNil(v) {
+			dst.Set(reflect.Zero(t))
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(t.Elem()))
+		}
+		return setGo(caller, dst.Elem(), v)
+	case reflect.Struct:
+		return setStruct(caller, dst, v)
+	default:
+		return fmt.Errorf("%s can't be converted to %s", toString(v), t)
+	}
+	return nil
+}
+
+// goInt is v as an int64, if it is an integer that fits in one.
+func goInt(v Value) (int64, bool) {
+	switch n := v.(type) {
+	case Int:
+		return int64(n), true
+	case *BigInt:
+		b := (*big.Int)(n)
+		return b.Int64(), b.IsInt64()
+	}
+	return 0, false
+}
+
+// goUint is v as a uint64, if it is an integer that fits in one.
+func goUint(v Value) (uint64, bool) {
+	switch n := v.(type) {
+	case Int:
+		return uint64(n), n >= 0
+	case *BigInt:
+		b := (*big.Int)(n)
+		return b.Uint64(), b.IsUint64()
+	}
+	return 0, false
+}
+
+// toFloat converts a number to the nearest float64.
+func toFloat(v Value) (float64, bool) {
+	switch n := v.(type) {
+	case Int:
+		return float64(n), true
+	case *BigInt:
+		f, _ := new(big.Float).SetInt(n.big()).Float64()
+		return f, true
+	case *Rat:
+		f, _ := n.big().Float64()
+		return f, true
+	}
+	return 0, false
+}
+
+// toGoMap converts a table or an association list to a map of type t.
+func toGoMap(caller *machine, v Value, t reflect.Type) (reflect.Value, error) {
+	tab, ok := v.(*Table)
+	if !ok {
+		var err error
+		if tab, err = tableFromAlist(v); err != nil {
+			return reflect.Value{}, fmt.Errorf("%s is not a table", toString(v))
+		}
+	}
+	m := reflect.MakeMapWithSize(t, tab.Len())
+	var err error
+	tab.Range(func(k, v Value) bool {
+		var gk, gv reflect.Value
+		if gk, err = toGo(caller, k, t.Key()); err != nil {
+			return false
+		}
+		if gv, err = toGo(caller, v, t.Elem()); err != nil {
+			return false
+		}
+		m.SetMapIndex(gk, gv)
+		return true
+	})
+	return m, err
+}
+
+// belFunction makes a Go function of type t that calls the Bel function fn. If
+// fn fails and t has no error to return, the function panics with the
+// *BelError, which goFunction recovers from. It panics the same way if fn calls
+// a continuation from outside it, to get back to the Bel that called Go.
+func belFunction(caller *machine, fn Value, t reflect.Type) reflect.Value {
+	fail := func(err *BelError) []reflect.Value {
+		n := t.NumOut()
+		if n == 0 || t.Out(n-1) != errorType {
+			panic(err)
+		}
+		out := make([]reflect.Value, n)
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+		out[n-1] = reflect.ValueOf(err)
+		return out
+	}
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		var args []Value
+		for i, a := range in {
+			if t.IsVariadic() && i == len(in)-1 {
+				for j := 0; j < a.Len(); j++ {
+					arg, err := fromGo(a.Index(j))
+					if err != nil {
+						return fail(belError(err))
+					}
+					args = append(args, arg)
+				}
+				break
+			}
+			arg, err := fromGo(a)
+			if err != nil {
+				return fail(belError(err))
+			}
+			args = append(args, arg)
+		}
+		result, err := apply(caller, fn, listOf(args...))
+		if j, ok := err.(*jump); ok {
+			panic(j)
+		}
+		if err != nil {
+			return fail(belError(err))
+		}
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+		if len(out) > 0 && t.Out(0) != errorType {
+			r, err := toGo(caller, result, t.Out(0))
+			if err != nil {
+				return fail(belError(err))
+			}
+			out[0] = r
+		}
+		return out
+	})
+}
+
+// fromGo converts a Go value to a Bel one.
+func fromGo(v reflect.Value) (Value, error) {
+	return goToBel(v, make(map[goRef]bool))
+}
+
+// goRef is a pointer or map that is being converted, along with its type, as a
+// pointer to a struct has the same address as a pointer to its first field.
+type goRef struct {
+	p uintptr
+	t reflect.Type
+}
+
+// goToBel converts v, with visiting holding the pointers and maps that v is
+// inside, so that one which refers back to itself is an error rather than an
+// endless loop.
+func goToBel(v reflect.Value, visiting map[goRef]bool) (Value, error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return Nil, nil
+	}
+	if v.CanInterface() {
+		if x, ok := v.Interface().(Value); ok {
+			return x, nil
+		}
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return normalizeInt(big.NewInt(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return normalizeInt(new(big.Int).SetUint64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		r, ok := new(big.Rat).SetString(strconv.FormatFloat(v.Float(), 'g', -1, 64))
+		if !ok {
+			return nil, fmt.Errorf("%v is not a number Bel has", v.Float())
+		}
+		return normalizeRat(r), nil
+	case reflect.String:
+		return belString(v.String()), nil
+	case reflect.Bool:
+		return truth(v.Bool()), nil
+	case reflect.Slice, reflect.Array:
+		items := make([]Value, v.Len())
+		for i := range items {
+			item, err := goToBel(v.Index(i), visiting)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return listOf(items...), nil
+	case reflect.Map:
+		ref := goRef{v.Pointer(), v.Type()}
+		if visiting[ref] {
+			return nil, fmt.Errorf("a %s can't be converted as it refers to itself", v.Type())
+		}
+		visiting[ref] = true
+		defer delete(visiting, ref)
+		return fromGoMap(v, visiting)
+	case reflect.Func:
+		if v.IsNil() {
+			return Nil, nil
+		}
+		if err := checkFunc(v.Type()); err != nil {
+			return nil, err
+		}
+		return goFunction(v.Type().String(), v), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return Nil, nil
+		}
+		ref := goRef{v.Pointer(), v.Type()}
+		if visiting[ref] {
+			return nil, fmt.Errorf("a %s can't be converted as it refers to itself", v.Type())
+		}
+		visiting[ref] = true
+		defer delete(visiting, ref)
+		return goToBel(v.Elem(), visiting)
+	case reflect.Struct:
+		return marshalStruct(v, visiting)
+	}
+	return nil, fmt.Errorf("a %s can't be converted to a Bel value", v.Type())
+}
+
+// fromGoMap converts a map to a table. Go doesn't keep maps in any order, so
+// the keys are added in the order they print in, so that converting the same
+// map always gives the same table.
+func fromGoMap(m reflect.Value, visiting map[goRef]bool) (Value, error) {
+	type entry struct {
+		k, v Value
+		s    string
+	}
+	entries := make([]entry, 0, m.Len())
+	iter := m.MapRange()
+	for iter.Next() {
+		k, err := goToBel(iter.Key(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		v, err := goToBel(iter.Value(), visiting)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{k, v, toString(k)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].s < entries[j].s
+	})
+	t := NewTable()
+	for _, e := range entries {
+		t.Set(e.k, e.v)
+	}
+	return t, nil
+}
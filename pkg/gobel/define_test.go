@@ -0,0 +1,129 @@
+package gobel
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDefine(t *testing.T) {
+	env := GlobalEnv()
+	env.Define("add", func(a, b int) int { return a + b })
+	env.Define("upcase", strings.ToUpper)
+	env.Define("not", func(b bool) bool { return !b })
+	env.Define("sum", func(ns ...int) int {
+		total := 0
+		for _, n := range ns {
+			total += n
+		}
+		return total
+	})
+	env.Define("lengths", func(ss []string) []int {
+		var ns []int
+		for _, s := range ss {
+			ns = append(ns, len(s))
+		}
+		return ns
+	})
+	env.Define("counts", func(m map[string]int) map[string]int {
+		out := make(map[string]int)
+		for k, v := range m {
+			out[strings.ToUpper(k)] = v * 2
+		}
+		return out
+	})
+	env.Define("twice", func(f func(int) int, n int) int { return f(f(n)) })
+	env.Define("adder", func(n int) func(int) int {
+		return func(m int) int { return n + m }
+	})
+	env.Define("half", func(n int) (int, error) {
+		if n%2 != 0 {
+			return 0, errors.New("odd number")
+		}
+		return n / 2, nil
+	})
+	env.Define("first", func(l *Pair) Value { return l.First })
+	env.Define("nothing", func() {})
+
+	cases := []evalCase{
+		{"integers", Read("(add 1 2)"), env, Int(3)},
+		{"strings", Read(`(upcase "abc")`), env, Read(`"ABC"`)[0]},
+		{"bools", Read("(list (not nil) (not 'a))"), env, Read("(t nil)")[0]},
+		{"variadic", Read("(sum 1 2 3 4)"), env, Int(10)},
+		{"variadic with nothing", Read("(sum)"), env, Int(0)},
+		{"slices", Read(`(lengths '("a" "bc" ""))`), env, Read("(1 2 0)")[0]},
+		{"maps from association lists", Read(`(tablist (counts '(("a" . 1) ("b" . 2))))`), env, Read(`(("A" . 2) ("B" . 4))`)[0]},
+		{"maps from tables", Read(`(tablist (counts (table '(("b" . 3)))))`), env, Read(`(("B" . 6))`)[0]},
+		{"functions as arguments", Read("(twice (fn (x) (* x 3)) 2)"), env, Int(18)},
+		{"functions as results", Read("((adder 3) 4)"), env, Int(7)},
+		{"a value and no error", Read("(half 4)"), env, Int(2)},
+		{"values as they are", Read("(first '(a b))"), env, Intern("a")},
+		{"no result", Read("(nothing)"), env, Nil},
+	}
+	testEvalCases(cases, t)
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			name    string
+			program string
+			msg     string
+		}{
+			{"a returned error", "(half 3)", "odd number"},
+			{"too many arguments", "(add 1 2 3)", "overargs: too many arguments to add"},
+			{"too few arguments", "(add 1)", "underargs: too few arguments to add"},
+			{"not an integer", "(add 1 'a)", "add: a is not an integer that fits in int"},
+			{"not a string", "(upcase 1)", "upcase: 1 is not a string"},
+			{"not a list", "(lengths 'a)", "lengths: a is not a list"},
+			{"not a table", "(counts 'a)", "counts: a is not a table"},
+			{"a Bel function that fails", "(twice (fn (x) (car x)) 2)", "car-on-atom: 2"},
+			{"a Bel function that returns the wrong type", "(twice (fn (x) 'a) 2)", "a is not an integer that fits in int"},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				_, err := Eval(Read(c.program), env)
+				if err, ok := err.(*BelError); !ok || err.Msg != c.msg {
+					t.Errorf("Expected the error %q from %s but got %v", c.msg, c.program, err)
+				}
+			})
+		}
+	})
+
+	t.Run("something that isn't a function", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected Define to panic")
+			}
+		}()
+		NewEnv(nil).Define("x", 1)
+	})
+}
+
+func TestFromGo(t *testing.T) {
+	cases := []struct {
+		name string
+		in   interface{}
+		want Value
+	}{
+		{"int", 3, Int(3)},
+		{"uint64", uint64(1) << 63, bigInt("9223372036854775808")},
+		{"string", "ab", Read(`"ab"`)[0]},
+		{"true", true, Intern("t")},
+		{"false", false, Nil},
+		{"array", [2]int{1, 2}, Read("(1 2)")[0]},
+		{"nested slices", [][]string{{"a"}, {}}, Read(`(("a") nil)`)[0]},
+		{"nil", nil, Nil},
+		{"a Value", Intern("a"), Intern("a")},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := fromGo(reflect.ValueOf(c.in))
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !Equal(got, c.want) {
+				t.Errorf("Expected %v but got %v", c.want, got)
+			}
+		})
+	}
+}
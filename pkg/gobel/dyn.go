@@ -0,0 +1,100 @@
+package gobel
+
+import "strings"
+
+// dyn evaluates (dyn v e1 e2): e2, with v bound dynamically to the value of
+// e1.
+func dyn(m *machine, l *Pair, env *Env) error {
+	if err := minArgs("dyn", 3, l); err != nil {
+		return err
+	}
+	name, ok := car(l).(*Symbol)
+	if !ok {
+		return belErrorf(TypeError, "dyn: %s is not a symbol", toString(car(l)))
+	}
+	rest := cdrPair(l)
+	return m.evalThen(car(rest), env, &dynFrame{name, cadr(rest), env})
+}
+
+// dynFrame waits for the value to bind name to.
+type dynFrame struct {
+	name *Symbol
+	body Value
+	env  *Env
+}
+
+func (f *dynFrame) resume(m *machine, v Value) error {
+	m.bind(f.name, v)
+	m.evalTail(f.body, f.env)
+	return nil
+}
+
+// catch evaluates (catch . body): the expressions in body, with throw bound
+// dynamically to a function that returns its argument from the catch.
+func catch(m *machine, l *Pair, env *Env) error {
+	if err := minArgs("catch", 1, l); err != nil {
+		return err
+	}
+	k := m.continuation()
+	m.bind(Intern("throw"), k)
+	m.evalBody(l, env)
+	return nil
+}
+
+// onErr evaluates (on-err f . body): the expressions in body, with err bound
+// dynamically to a handler. An error signalled while they're evaluated, by
+// calling err or by anything else going wrong, calls f with the error, in the
+// context where it happened, so f can throw to a catch inside the on-err. What
+// f returns is returned from the on-err.
+func onErr(m *machine, l *Pair, env *Env) error {
+	if err := minArgs("on-err", 2, l); err != nil {
+		return err
+	}
+	return m.evalThen(car(l), env, &onErrFrame{cdrPair(l), env})
+}
+
+// onErrFrame waits for the function that handles errors in body.
+type onErrFrame struct {
+	body *Pair
+	env  *Env
+}
+
+func (f *onErrFrame) resume(m *machine, handler Value) error {
+	k := m.continuation()
+	var b *dynBinding
+	b = m.bind(Intern("err"), &NativeProcedure{step: func(m *machine, args *Pair) error {
+		m.dyn = m.dyn.without(b)
+		m.push(&resumeFrame{k})
+		return m.apply(handler, listOf(errFromArgs(args)))
+	}})
+	m.evalBody(f.body, f.env)
+	return nil
+}
+
+// resumeFrame waits for a value to carry on with k with.
+type resumeFrame struct {
+	k *Continuation
+}
+
+func (f *resumeFrame) resume(m *machine, v Value) error {
+	return m.resume(f.k, v)
+}
+
+// errFromArgs is the error that (err . args) signals. An error is signalled
+// as it is, so that a handler can pass it on. Otherwise the message is the
+// arguments, separated by spaces, with strings as they are rather than
+// quoted.
+func errFromArgs(args *Pair) *BelError {
+	if e, ok := car(args).(*BelError); ok && isNil(cdr(args)) {
+		return e
+	}
+	var words []string
+	for ; args != Nil; args = cdrPair(args) {
+		s, ok := goString(args.First)
+		if !ok || isNil(args.First) {
+			s = toString(args.First)
+		}
+		words = append(words, s)
+	}
+	return &BelError{Kind: OtherError, Msg: strings.Join(words, " ")}
+}
@@ -0,0 +1,157 @@
+package gobel
+
+import (
+	"testing"
+)
+
+func TestDyn(t *testing.T) {
+	env := GlobalEnv()
+	_, err := Eval(Read(`
+(def getdv () dv)
+(def each-key (f tab) (maptable (fn (k v) (f k)) tab))
+`), env)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cases := []evalCase{
+		{"seen by functions called inside", Read("(dyn dv 'a (getdv))"), env, Intern("a")},
+		{"ahead of lexical bindings", Read("(let dv 'lexical (dyn dv 'dynamic dv))"), env, Intern("dynamic")},
+		{"innermost first", Read("(dyn dv 'a (dyn dv 'b (getdv)))"), env, Intern("b")},
+		{"ended by returning", Read("(list (dyn dv 'a (getdv)) (dyn dv 'b (getdv)))"), env, Read("(a b)")[0]},
+		{"ended by a continuation", Read("(dyn dv 'outer (list (ccc (fn (k) (dyn dv 'inner (k (getdv))))) (getdv)))"), env, Read("(inner outer)")[0]},
+		{"seen from maptable", Read("(dyn dv 'a (ccc (fn (k) (each-key (fn (key) (k (getdv))) (table '((b . 1)))))))"), env, Intern("a")},
+	}
+	testEvalCases(cases, t)
+
+	t.Run("missing arguments", func(t *testing.T) {
+		testArityErrors([]string{"(dyn)", "(dyn dv)", "(dyn dv 'a)"}, env, t)
+	})
+
+	t.Run("gone after the dyn", func(t *testing.T) {
+		_, err := Eval(Read("(dyn dv 'a nil) (getdv)"), env)
+		if e, ok := err.(*BelError); !ok || e.Kind != UnboundError {
+			t.Errorf("Expected an unbound error but got %v", err)
+		}
+	})
+}
+
+func TestCatch(t *testing.T) {
+	env := GlobalEnv()
+	env.Define("each", func(f func(int), ns []int) {
+		for _, n := range ns {
+			f(n)
+		}
+	})
+	_, err := Eval(Read(`
+(def find-first (f xs)
+  (catch
+    (map (fn (x) (if (f x) (throw x))) xs)
+    nil))
+`), env)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cases := []evalCase{
+		{"without a throw", Read("(catch 'a 'b)"), env, Intern("b")},
+		{"a throw", Read("(catch (throw 'a) 'b)"), env, Intern("a")},
+		{"a throw with nothing", Read("(catch (throw) 'b)"), env, Nil},
+		{"from a function", Read("(find-first (fn (x) (id x 'c)) '(a b c d))"), env, Intern("c")},
+		{"to the innermost catch", Read("(catch (list 1 (catch (throw 2) 3) 4))"), env, Read("(1 2 4)")[0]},
+		{"out of a Go callback", Read("(catch (each (fn (n) (if (id n 2) (throw n))) '(1 2 3)) 'none)"), env, Int(2)},
+		{"out of maptable", Read("(catch (maptable (fn (k v) (throw k)) (table '((a . 1)))))"), env, Intern("a")},
+	}
+	testEvalCases(cases, t)
+
+	t.Run("missing arguments", func(t *testing.T) {
+		testArityErrors([]string{"(catch)"}, env, t)
+	})
+
+	t.Run("outside a catch", func(t *testing.T) {
+		_, err := Eval(Read("(throw 'a)"), env)
+		if e, ok := err.(*BelError); !ok || e.Kind != UnboundError {
+			t.Errorf("Expected an unbound error but got %v", err)
+		}
+	})
+}
+
+func TestOnErr(t *testing.T) {
+	env := GlobalEnv()
+	env.Define("each", func(f func(int), ns []int) {
+		for _, n := range ns {
+			f(n)
+		}
+	})
+	_, err := Eval(Read(`
+(def safe-car (x)
+  (on-err (fn (e) 'no-car) (car x)))
+`), env)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cases := []evalCase{
+		{"no error", Read("(on-err (fn (e) 'caught) 'fine)"), env, Intern("fine")},
+		{"err", Read("(on-err (fn (e) 'caught) (err 'oops) 'not-reached)"), env, Intern("caught")},
+		{"the error", Read("(on-err (fn (e) (type e)) (err 'oops))"), env, Intern("err")},
+		{"a type error", Read("(list (safe-car '(a)) (safe-car 'a))"), env, Read("(a no-car)")[0]},
+		{"an unbound variable", Read("(on-err (fn (e) 'caught) no-such-variable)"), env, Intern("caught")},
+		{"too many arguments", Read("(on-err (fn (e) 'caught) ((fn (x) x) 1 2))"), env, Intern("caught")},
+		{"not a function", Read("(on-err (fn (e) 'caught) (1 2))"), env, Intern("caught")},
+		{"from a Go callback", Read("(on-err (fn (e) 'caught) (each (fn (n) (car n)) '(1)))"), env, Intern("caught")},
+		{"from maptable", Read("(on-err (fn (e) 'caught) (maptable (fn (k v) (car v)) (table '((a . 1)))))"), env, Intern("caught")},
+		{"the innermost handler", Read("(on-err (fn (e) 'outer) (on-err (fn (e) 'inner) (err 'oops)))"), env, Intern("inner")},
+		{"errors in the handler", Read("(on-err (fn (e) 'outer) (on-err (fn (e) (car e)) (err 'oops)))"), env, Intern("outer")},
+		{"passed on by the handler", Read("(on-err (fn (e) (type e)) (on-err (fn (e) (err e)) (err 'oops)))"), env, Intern("err")},
+		{"a handler that returns", Read("(on-err (fn (e) 'outer) (dyn err (fn (e) 'ignored) (car 'a)))"), env, Intern("outer")},
+		{"in the signalling context", Read("(on-err (fn (e) (throw 'recovered)) (list 'a (catch (car 'b))))"), env, Read("(a recovered)")[0]},
+	}
+	testEvalCases(cases, t)
+
+	t.Run("messages", func(t *testing.T) {
+		got, err := Eval(Read(`(on-err (fn (e) e) (err "can't open" 'file 1))`), env)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if e, ok := got.(*BelError); !ok || e.Msg != "can't open file 1" {
+			t.Errorf(`Expected the error "can't open file 1" but got %v`, got)
+		}
+	})
+
+	t.Run("kinds", func(t *testing.T) {
+		got, err := Eval(Read("(on-err (fn (e) e) (car 'a))"), env)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if e, ok := got.(*BelError); !ok || e.Kind != TypeError {
+			t.Errorf("Expected a type error but got %v", got)
+		}
+	})
+
+	t.Run("missing arguments", func(t *testing.T) {
+		testArityErrors([]string{"(on-err)", "(on-err (fn (e) 'caught))"}, env, t)
+	})
+
+	t.Run("without a handler", func(t *testing.T) {
+		_, err := Eval(Read("(err 'oops 1)"), env)
+		e, ok := err.(*BelError)
+		if !ok || e.Msg != "oops 1" {
+			t.Fatalf("Expected the error oops 1 but got %v", err)
+		}
+		if len(e.Stack) != 1 || !Equal(e.Stack[0], Read("(err 'oops 1)")[0]) {
+			t.Errorf("Expected the call to err on the stack but got %v", e.Stack)
+		}
+	})
+}
+
+// testArityErrors checks that each of programs fails with an arity error.
+func testArityErrors(programs []string, env *Env, t *testing.T) {
+	t.Helper()
+	for _, program := range programs {
+		_, err := Eval(Read(program), env)
+		if e, ok := err.(*BelError); !ok || e.Kind != ArityError {
+			t.Errorf("Expected an arity error from %s but got %v", program, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package gobel
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"reflect"
+)
+
+// Equal reports whether a and b are structurally equal, which is what Bel's =
+// means: pairs are equal if their cars and cdrs are, numbers if they have the
+// same value, and anything else only if it's the same under id. Lists that
+// contain themselves are compared without looping forever.
+func Equal(a, b Value) bool {
+	var c comparison
+	return c.equal(a, b)
+}
+
+// trackAfter is how many pairs Equal compares before it starts keeping track
+// of them to find cycles, so that comparing lists that don't have any, which
+// is most of them, doesn't allocate.
+const trackAfter = 1000
+
+// pairOfPairs is two pairs that are being compared.
+type pairOfPairs struct {
+	a, b *Pair
+}
+
+// comparison is the state of a call to Equal: how many pairs it has compared,
+// and once that passes trackAfter, the pairs that are being compared.
+type comparison struct {
+	steps     int
+	comparing map[pairOfPairs]bool
+}
+
+func (c *comparison) equal(a, b Value) bool {
+	for {
+		pa, ok := a.(*Pair)
+		if !ok || pa == Nil {
+			return equalAtoms(a, b)
+		}
+		pb, ok := b.(*Pair)
+		if !ok || pb == Nil {
+			return false
+		}
+		if pa == pb {
+			return true
+		}
+		// if these pairs are already being compared further up, any difference
+		// will be found there. A cycle goes round more than trackAfter times
+		// if it has to, so it's found once tracking starts.
+		if c.steps++; c.steps > trackAfter {
+			if c.comparing == nil {
+				c.comparing = make(map[pairOfPairs]bool)
+			}
+			if c.comparing[pairOfPairs{pa, pb}] {
+				return true
+			}
+			c.comparing[pairOfPairs{pa, pb}] = true
+		}
+		if !c.equal(pa.First, pb.First) {
+			return false
+		}
+		a, b = pa.Rest, pb.Rest
+	}
+}
+
+func equalAtoms(a, b Value) bool {
+	switch x := a.(type) {
+	case *BigInt:
+		y, ok := b.(*BigInt)
+		return ok && x.big().Cmp(y.big()) == 0
+	case *Rat:
+		y, ok := b.(*Rat)
+		return ok && x.big().Cmp(y.big()) == 0
+	case nil:
+		return isNil(b) || b == nil
+	}
+	if b == nil {
+		return isNil(a)
+	}
+	return id(a, b)
+}
+
+// hashPairs is how many pairs Hash looks at, counting those in the cars of a
+// list as well as along it. Lists that only differ further on than that hash
+// the same, which keeps hashing long or circular lists cheap.
+const hashPairs = 64
+
+// Hash returns a hash of v that agrees with Equal: values that are Equal have
+// the same hash.
+func Hash(v Value) uint64 {
+	h := fnv.New64a()
+	budget := hashPairs
+	var buf [8]byte
+	var hash func(v Value)
+	hash = func(v Value) {
+		switch x := v.(type) {
+		case nil:
+			h.Write([]byte{'n'})
+		case *Pair:
+			if x == Nil {
+				h.Write([]byte{'n'})
+				return
+			}
+			h.Write([]byte{'('})
+			for x != Nil && budget > 0 {
+				// taken before hashing the car, which may lead back to x
+				budget--
+				hash(x.First)
+				next, ok := x.Rest.(*Pair)
+				if !ok {
+					h.Write([]byte{'.'})
+					hash(x.Rest)
+					return
+				}
+				x = next
+			}
+		case *Symbol:
+			h.Write([]byte{'s'})
+			h.Write([]byte(x.name))
+		case Char:
+			h.Write([]byte{'c'})
+			binary.LittleEndian.PutUint64(buf[:], uint64(x))
+			h.Write(buf[:])
+		case Int, *BigInt, *Rat:
+			h.Write([]byte{'#'})
+			h.Write([]byte(x.String()))
+		default:
+			// everything else is only equal to itself
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr {
+				h.Write([]byte{'p'})
+				binary.LittleEndian.PutUint64(buf[:], uint64(rv.Pointer()))
+				h.Write(buf[:])
+			}
+		}
+	}
+	hash(v)
+	return h.Sum64()
+}
@@ -0,0 +1,104 @@
+package gobel
+
+import (
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	circular := func() *Pair {
+		p := listOf(Int(1), Int(2))
+		p.Rest.(*Pair).Rest = p
+		return p
+	}
+
+	cases := []struct {
+		name  string
+		a, b  Value
+		equal bool
+	}{
+		{"symbols", Intern("a"), Intern("a"), true},
+		{"different symbols", Intern("a"), Intern("b"), false},
+		{"characters", Char('a'), Char('a'), true},
+		{"integers", Int(1), Int(1), true},
+		{"big integers", bigInt("123456789012345678901234567890"), bigInt("123456789012345678901234567890"), true},
+		{"ratios", rat(1, 2), rat(2, 4), true},
+		{"different ratios", rat(1, 2), rat(1, 3), false},
+		{"number and character", Int(97), Char('a'), false},
+		{"lists", Read("(a (b 1) . c)")[0], Read("(a (b 1) . c)")[0], true},
+		{"different lists", Read("(a (b 1))")[0], Read("(a (b 2))")[0], false},
+		{"longer list", Read("(a b)")[0], Read("(a b c)")[0], false},
+		{"strings", belString("abc"), belString("abc"), true},
+		{"nil and Nil", nil, Nil, true},
+		{"nil and empty list", Nil, Read("()")[0], true},
+		{"list and nil", Read("(a)")[0], Nil, false},
+		{"circular lists", circular(), circular(), true},
+		{"circular and not", circular(), listOf(Int(1), Int(2), Int(1), Int(2)), false},
+		{"circular from a different start", circular(), Read("(1 2 . #1=(1 2 . #1#))")[0], true},
+		{"lists that contain themselves", Read("#1=(#1#)")[0], Read("#1=(#1#)")[0], true},
+		{"lists that contain themselves differently", Read("#1=(#1# a)")[0], Read("#1=(#1# b)")[0], false},
+		{"long lists", longList(5000), longList(5000), true},
+		{"tables", NewTable(), NewTable(), false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := Equal(c.a, c.b); got != c.equal {
+				t.Errorf("Expected Equal(%v, %v) to be %v", toString(c.a), toString(c.b), c.equal)
+			}
+			if got := Equal(c.b, c.a); got != c.equal {
+				t.Errorf("Expected Equal(%v, %v) to be %v", toString(c.b), toString(c.a), c.equal)
+			}
+			if c.equal && Hash(c.a) != Hash(c.b) {
+				t.Errorf("Expected %v and %v to hash the same", toString(c.a), toString(c.b))
+			}
+		})
+	}
+
+	t.Run("lists without cycles don't allocate", func(t *testing.T) {
+		a, b := Read(`(a (b "c") 1 2 3)`)[0], Read(`(a (b "c") 1 2 3)`)[0]
+		if n := testing.AllocsPerRun(100, func() { Equal(a, b) }); n != 0 {
+			t.Errorf("Expected Equal not to allocate but it made %v allocations", n)
+		}
+	})
+
+	t.Run("hashes differ", func(t *testing.T) {
+		if Hash(Read("(a b)")[0]) == Hash(Read("(a c)")[0]) {
+			t.Errorf("Expected different lists to hash differently")
+		}
+		if Hash(Intern("a")) == Hash(Char('a')) {
+			t.Errorf("Expected a symbol and a character to hash differently")
+		}
+	})
+
+	t.Run("=", func(t *testing.T) {
+		cases := []evalCase{
+			{"lists", Read("(= '(a (b)) '(a (b)))"), GlobalEnv(), Intern("t")},
+			{"different lists", Read("(= '(a (b)) '(a (c)))"), GlobalEnv(), Nil},
+			{"strings", Read(`(= "abc" "abc")`), GlobalEnv(), Intern("t")},
+			{"several", Read("(= 1 1 1)"), GlobalEnv(), Intern("t")},
+			{"several different", Read("(= 1 1 2)"), GlobalEnv(), Nil},
+			{"one", Read("(= 'a)"), GlobalEnv(), Intern("t")},
+			{"none", Read("(=)"), GlobalEnv(), Intern("t")},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("table keys", func(t *testing.T) {
+		cases := []evalCase{
+			{"string keys", Read(`(set tab (table)) (set (tab "k") 1) (tab "k")`), GlobalEnv(), Int(1)},
+			{"list keys", Read("(set tab (table)) (set (tab '(a b)) 1) (tab (list 'a 'b))"), GlobalEnv(), Int(1)},
+			{"equal keys are replaced", Read(`(set tab (table)) (set (tab "k") 1) (set (tab "k") 2) (vals tab)`), GlobalEnv(), listOf(Int(2))},
+			{"delete then look up", Read(`(set tab (table '(("a" . 1) ("b" . 2)))) (set (tab "a") nil) (tab "b")`), GlobalEnv(), Int(2)},
+			{"keys that contain themselves", Read("(set tab (table)) (set (tab '#1=(#1#)) 1) (tab '#1=(#1#))"), GlobalEnv(), Int(1)},
+		}
+		testEvalCases(cases, t)
+	})
+}
+
+// longList is a list of the numbers up to n.
+func longList(n int) *Pair {
+	items := make([]Value, n)
+	for i := range items {
+		items[i] = Int(i)
+	}
+	return listOf(items...)
+}
@@ -1,287 +1,412 @@
 package gobel
 
-import (
-	"errors"
-	"fmt"
-)
+import "os"
 
-func Eval(expressions []interface{}, env *Env) interface{} {
-	var r interface{}
+// Eval evaluates each of expressions in turn in env, and returns the value of
+// the last. It stops at the first one that fails, and returns a *BelError.
+func Eval(expressions []Value, env *Env) (Value, error) {
+	var r Value = Nil
 	for i := range expressions {
-		r = eval(expressions[i], env)
+		var err error
+		if r, err = eval(nil, expressions[i], env); err != nil {
+			return nil, belError(err)
+		}
 	}
-	return r
+	return r, nil
 }
 
-func eval(expression interface{}, env *Env) interface{} {
-	switch v := expression.(type) {
-	case nil:
-		return Nil
-	case int:
-		return v
-	case *Symbol:
-		return env.get(v.Str)
-	case *Pair:
-		if v == Nil {
-			return Nil
-		}
-		first := eval(v.First, env)
-		switch t := first.(type) {
-		case *SpecialForm:
-			return t.form(v.Rest.(*Pair), env)
-		}
-		return apply(first, listOfValues(v.Rest.(*Pair), env))
-	default:
-		return fmt.Errorf("eh??? %v", v)
+// properList returns v as a list, and whether it is a proper one: one that
+// ends in nil rather than some other atom.
+func properList(v Value) (*Pair, bool) {
+	l, ok := v.(*Pair)
+	for p := l; ok && p != Nil; p, ok = p.Rest.(*Pair) {
 	}
+	return l, ok
 }
 
 type Procedure struct {
 	env        *Env
-	parameters interface{}
+	parameters Value
 	body       *Pair
 }
 
 type NativeProcedure struct {
-	application func(args *Pair) interface{}
+	application func(args *Pair) (Value, error)
+	// step, if it's set, is called instead of application, by natives like
+	// ccc that work on the rest of the computation
+	step func(m *machine, args *Pair) error
 }
 
-func apply(p interface{}, args *Pair) interface{} {
-	nproc, ok := p.(*NativeProcedure)
-	if ok {
-		return nproc.application(args)
-	}
-	proc, ok := p.(*Procedure)
-	if !ok {
-		fmt.Println(p)
-		panic("apply fallthrough!")
-	}
+// Macro is a procedure that's called with the unevaluated arguments of the
+// expression it heads. What it returns is evaluated in place of the expression.
+type Macro struct {
+	procedure *Procedure
+}
 
-	env, err := extendEnv(proc.parameters, args, proc.env)
-	if err != nil {
-		return err
+func extendEnv(m *machine, parameters Value, args *Pair, env *Env) (*Env, error) {
+	e := NewEnv(env)
+	if err := bind(m, parameters, args, e); err != nil {
+		return env, err
 	}
-	return evalSeq(proc.body, env)
+	return e, nil
 }
 
-func extendEnv(parameters interface{}, args *Pair, env *Env) (*Env, error) {
-	e := NewEnv(env)
-	switch expr := parameters.(type) {
+// bind binds the variables in the parameter list parms to the parts of arg
+// they match. As in Bel, parameter lists can be nested to take apart the
+// arguments, end in a dotted symbol to take the rest, and include optional
+// parameters written (o var default). A default is evaluated after the
+// parameters before it have been bound, and is nil if it's left out. Defaults
+// are evaluated on machines inside m.
+func bind(m *machine, parms, arg Value, env *Env) error {
+	switch p := parms.(type) {
 	case *Symbol:
-		e.bindings[expr.String()] = args
+		env.bindings[p.name] = arg
 	case *Pair:
-		for {
-			if args == Nil && expr == Nil {
-				break
+		for p != Nil {
+			args, ok := arg.(*Pair)
+			if !ok {
+				return belErrorf(TypeError, "atom-arg: %s doesn't match %s", toString(arg), toString(p))
 			}
-			if isNil(expr) {
-				return env, fmt.Errorf("Not enough arguments")
+			if name, def, ok := optional(p.First); ok {
+				v := Value(Nil)
+				if args != Nil {
+					v = args.First
+				} else if def != nil {
+					var err error
+					if v, err = eval(m, def, env); err != nil {
+						return err
+					}
+				}
+				env.bindings[name.name] = v
+			} else {
+				if args == Nil {
+					return belErrorf(ArityError, "underargs: not enough arguments")
+				}
+				if err := bind(m, p.First, args.First, env); err != nil {
+					return err
+				}
 			}
-			if isNil(args) {
-				return env, fmt.Errorf("Too few arguments")
+			if args != Nil {
+				arg = args.Rest
 			}
-
-			e.bindings[car(expr).(*Symbol).Str] = car(args)
-
-			args = cdr(args).(*Pair)
-			expr = cdr(expr).(*Pair)
+			rest, ok := p.Rest.(*Pair)
+			if !ok {
+				return bind(m, p.Rest, arg, env)
+			}
+			p = rest
+		}
+		if !isNil(arg) {
+			return belErrorf(ArityError, "overargs: too many arguments")
 		}
 	}
-	return e, nil
-}
-
-func procedureBody(proc *Pair) *Pair {
-	return cadddr(proc).(*Pair)
+	return nil
 }
 
-func cadddr(p *Pair) interface{} {
-	return car(cdr(cdr(cdr(p).(*Pair)).(*Pair)).(*Pair)).(*Pair)
-}
-
-func listOfValues(expressions *Pair, env *Env) *Pair {
-	if isNil(expressions) {
-		return Nil
+// optional picks apart an optional parameter, (o var default).
+func optional(parm Value) (name *Symbol, def Value, ok bool) {
+	p, ok := parm.(*Pair)
+	if !ok || p == Nil || p.First != Intern("o") {
+		return nil, nil, false
 	}
-	return cons(eval(car(expressions), env), listOfValues(cdr(expressions).(*Pair), env))
-}
-
-func evalSeq(exps *Pair, env *Env) interface{} {
-	if lastExpression(exps) {
-		return eval(firstExpression(exps), env)
+	rest, _ := p.Rest.(*Pair)
+	name, ok = car(rest).(*Symbol)
+	if !ok {
+		return nil, nil, false
 	}
-	eval(firstExpression(exps), env)
-	return evalSeq(cdr(exps).(*Pair), env)
-}
-
-func firstExpression(exps *Pair) interface{} {
-	return car(exps)
-}
-
-func lastExpression(exps *Pair) bool {
-	return cdr(exps).(*Pair) == Nil
+	if tail, _ := cdr(rest).(*Pair); tail != Nil {
+		def = tail.First
+	}
+	return name, def, true
 }
 
 type Env struct {
 	outer    *Env
-	bindings map[string]interface{}
+	bindings map[string]Value
 }
 
 func NewEnv(outer *Env) *Env {
 	return &Env{
 		outer:    outer,
-		bindings: make(map[string]interface{}),
+		bindings: make(map[string]Value),
 	}
 }
 
-func (env *Env) get(name string) interface{} {
+func (env *Env) get(name string) (Value, error) {
 	v, present := env.bindings[name]
 	if present {
-		return v
+		return v, nil
 	}
 	if env.outer != nil {
 		return env.outer.get(name)
 	}
 
-	return errors.New(fmt.Sprintf("No binding for %s in scope", name))
+	return nil, belErrorf(UnboundError, "No binding for %s in scope", name)
 }
 
-func (env *Env) set(name string, value interface{}) interface{} {
+// assign changes the binding of name wherever it's bound, or binds it in the
+// outermost environment if it isn't bound anywhere, which is how Bel's set
+// works.
+func (env *Env) assign(name string, value Value) {
+	e := env
+	for ; e.outer != nil; e = e.outer {
+		if _, ok := e.bindings[name]; ok {
+			break
+		}
+	}
+	e.bindings[name] = value
+}
+
+func (env *Env) set(name string, value Value) Value {
 	env.bindings[name] = value
 	return value
 }
 
+// GlobalEnv returns a new environment with everything Bel defines in it, with
+// standard input and output as its default streams.
 func GlobalEnv() *Env {
+	return GlobalEnvWithStreams(NewInStream(os.Stdin), NewOutStream(os.Stdout))
+}
+
+// GlobalEnvWithStreams returns a new environment like GlobalEnv's, whose
+// default streams, the ones that nil stands for, are stdin and stdout. A host
+// that reads expressions from stdin itself should read them with
+// stdin.Reader().
+func GlobalEnvWithStreams(stdin, stdout *Stream) *Env {
 	m := NewEnv(nil)
-	m.set("lambda", &SpecialForm{newProceedure})
-	m.set("set", &SpecialForm{set})
-	m.set("if", &SpecialForm{belIf})
-	m.set("quote", &SpecialForm{quote})
-	m.set("define", &SpecialForm{define})
-
-	m.set("+", &NativeProcedure{func(l *Pair) interface{} {
-		result := 0
-		next := l
-		for next != nil {
-			result += (next.First).(int)
-			next = next.Rest.(*Pair)
-		}
-		return result
+	m.set("lambda", &SpecialForm{form: newProceedure})
+	m.set("macro", &SpecialForm{form: newMacro})
+	m.set("set", &SpecialForm{step: set})
+	m.set("if", &SpecialForm{step: belIf})
+	m.set("quote", &SpecialForm{form: quote})
+	m.set("define", &SpecialForm{step: define})
+	m.set("bquote", &SpecialForm{step: bquote})
+	m.set("ccc", &NativeProcedure{step: callCC})
+	m.set("dyn", &SpecialForm{step: dyn})
+	m.set("catch", &SpecialForm{step: catch})
+	m.set("on-err", &SpecialForm{step: onErr})
+	m.set("err", &NativeProcedure{application: func(l *Pair) (Value, error) {
+		return nil, errFromArgs(l)
 	}})
 
-	m.set("-", &NativeProcedure{func(l *Pair) interface{} {
-		result := 0
-		next := l
-		if next == Nil {
-			return 0
-		}
-		if next.Rest == Nil {
-			return -next.First.(int)
+	definePrimitives(m)
+	defineTables(m)
+	defineStreams(m, stdin, stdout)
+
+	m.set("+", &NativeProcedure{application: func(l *Pair) (Value, error) {
+		return foldNumbers(l, Int(0), add)
+	}})
+
+	m.set("-", &NativeProcedure{application: func(l *Pair) (Value, error) {
+		if l == Nil {
+			return Int(0), nil
 		}
-		result = next.First.(int)
-		next = next.Rest.(*Pair)
-		for next != Nil {
-			result -= next.First.(int)
-			next = next.Rest.(*Pair)
+		if isNil(l.Rest) {
+			return foldNumbers(l, Int(0), sub)
 		}
-		return result
+		return foldNumbers(cdrPair(l), l.First, sub)
 	}})
 
-	m.set("cons", &NativeProcedure{func(args *Pair) interface{} {
-		return cons(car(args), car(cdr(args).(*Pair)))
+	m.set("*", &NativeProcedure{application: func(l *Pair) (Value, error) {
+		return foldNumbers(l, Int(1), mul)
 	}})
 
-	m.set("car", &NativeProcedure{func(args *Pair) interface{} {
-		return car(car(args).(*Pair))
+	m.set("/", &NativeProcedure{application: func(l *Pair) (Value, error) {
+		if l == Nil {
+			return nil, belErrorf(ArityError, "/ needs at least one argument")
+		}
+		if isNil(l.Rest) {
+			return foldNumbers(l, Int(1), div)
+		}
+		return foldNumbers(cdrPair(l), l.First, div)
 	}})
 
-	m.set("cdr", &NativeProcedure{func(args *Pair) interface{} {
-		return cdr(car(args).(*Pair))
+	m.set("expt", &NativeProcedure{application: func(l *Pair) (Value, error) {
+		if err := minArgs("expt", 2, l); err != nil {
+			return nil, err
+		}
+		args, err := fixedArgs("expt", 2, l)
+		if err != nil {
+			return nil, err
+		}
+		return expt(args[0], args[1])
 	}})
 
-	m.set("list", eval(Read("(lambda args args)")[0], m))
-	m.set("map", eval(Read("(lambda (f xs) (if xs (cons (f (car xs)) (map (cdr xs) f)) nil))")[0], m))
-
 	m.set("test-procedure", &Procedure{
 		parameters: &Pair{
-			First: &Symbol{Str: "x"},
-			Rest:  &Pair{&Symbol{"y"}, Nil},
+			First: Intern("x"),
+			Rest:  &Pair{Intern("y"), Nil},
 		},
 		env:  m,
 		body: &Pair{Read("(+ x y)")[0].(*Pair), Nil},
 	})
 
+	loadPrelude(m)
 	return m
 }
 
-func set(l *Pair, env *Env) interface{} {
-	name, ok := l.First.(*Symbol)
+// foldNumbers combines each of the numbers in l in turn with result.
+func foldNumbers(l *Pair, result Value, op func(a, b Value) (Value, error)) (Value, error) {
+	if !isNumber(result) {
+		return nil, belErrorf(TypeError, "%s is not a number", toString(result))
+	}
+	for next := l; next != Nil; next = cdrPair(next) {
+		var err error
+		if result, err = op(result, next.First); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func set(m *machine, l *Pair, env *Env) error {
+	if err := minArgs("set", 1, l); err != nil {
+		return err
+	}
+	return m.evalThen(cadr(l), env, &setFrame{car(l), env})
+}
+
+// setFrame waits for the value to assign to place.
+type setFrame struct {
+	place Value
+	env   *Env
+}
+
+func (f *setFrame) resume(m *machine, value Value) error {
+	if place, ok := f.place.(*Pair); ok && place != Nil {
+		v, err := setPlace(m, place, value, f.env)
+		if err != nil {
+			return err
+		}
+		m.ret(v)
+		return nil
+	}
+	name, ok := f.place.(*Symbol)
 	if !ok {
-		return errors.New("cannot assign to something that's not a symbol")
+		return belErrorf(TypeError, "cannot assign to something that's not a symbol")
 	}
-	value := eval(l.Rest.(*Pair).First, env)
-	env.set(name.Str, value)
-	return value
+	f.env.assign(name.name, value)
+	m.ret(value)
+	return nil
 }
 
-func newProceedure(l *Pair, env *Env) interface{} {
+func newProceedure(l *Pair, env *Env) (Value, error) {
+	if err := minArgs("lambda", 1, l); err != nil {
+		return nil, err
+	}
 	return &Procedure{
 		env:        env,
 		parameters: car(l),
-		body:       cdr(l).(*Pair),
-	}
+		body:       cdrPair(l),
+	}, nil
 }
 
-func define(l *Pair, env *Env) interface{} {
-	return set(cons(car(l), cons(cons(&Symbol{"lambda"}, cdr(l).(*Pair)), Nil)), env)
+func define(m *machine, l *Pair, env *Env) error {
+	if err := minArgs("define", 2, l); err != nil {
+		return err
+	}
+	if _, ok := l.First.(*Symbol); !ok {
+		return belErrorf(TypeError, "cannot define %s, which is not a symbol", toString(l.First))
+	}
+	return set(m, cons(car(l), cons(cons(Intern("lambda"), cdrPair(l)), Nil)), env)
 }
 
-func quote(l *Pair, _ *Env) interface{} {
-	return l.First
+func quote(l *Pair, _ *Env) (Value, error) {
+	return car(l), nil
 }
 
+// SpecialForm is an operator that is given its arguments unevaluated. Either
+// form works out its value, or step carries on the computation on the machine,
+// for forms like if that need to evaluate some of their arguments first.
 type SpecialForm struct {
-	form func(*Pair, *Env) interface{}
+	form func(*Pair, *Env) (Value, error)
+	step func(*machine, *Pair, *Env) error
 }
 
-func belIf(l *Pair, env *Env) interface{} {
-	condition := eval(l.First, env)
-	if !isNil(condition) {
-		return eval(car(cdr(l).(*Pair)), env)
+// belIf evaluates (if a b c d e ...): b if a is true, otherwise d if c is
+// true, and so on, with a final odd expression as the else branch. The branch
+// is evaluated in place of the if.
+func belIf(m *machine, l *Pair, env *Env) error {
+	if l == Nil {
+		m.ret(Nil)
+		return nil
 	}
-
-	if v, ok := l.Rest.(*Pair).Rest.(*Pair); ok && isNil(v) {
-		return Nil
+	if isNil(l.Rest) {
+		m.evalTail(l.First, env)
+		return nil
 	}
+	return m.evalThen(l.First, env, &ifFrame{l, env})
+}
+
+// ifFrame waits for the test at the head of clauses.
+type ifFrame struct {
+	clauses *Pair
+	env     *Env
+}
 
-	if v, ok := l.Rest.(*Pair).Rest.(*Pair).Rest.(*Pair); ok && isNil(v) {
-		return l.Rest.(*Pair).Rest.(*Pair).First
+func (f *ifFrame) resume(m *machine, test Value) error {
+	if !isNil(test) {
+		m.evalTail(cadr(f.clauses), f.env)
+		return nil
 	}
+	return belIf(m, cdrPair(cdrPair(f.clauses)), f.env)
+}
 
-	return belIf(l.Rest.(*Pair).Rest.(*Pair), env)
+func newMacro(l *Pair, env *Env) (Value, error) {
+	if err := minArgs("macro", 1, l); err != nil {
+		return nil, err
+	}
+	return &Macro{&Procedure{
+		env:        env,
+		parameters: car(l),
+		body:       cdrPair(l),
+	}}, nil
 }
 
-func id(a, b interface{}) bool {
-	if ap, aok := a.(*Pair); aok {
-		if bp, bok := b.(*Pair); bok {
-			return bp == ap
-		}
+// id reports whether a and b are the same object. Symbols are interned, and
+// characters and numbers are values rather than objects, so those are the same
+// whenever they're equal, however big they are. Pairs and procedures are only
+// the same if they're the very same pointer.
+func id(a, b Value) bool {
+	if a == nil || b == nil {
+		return false
 	}
+	switch x := a.(type) {
+	case *BigInt:
+		y, ok := b.(*BigInt)
+		return ok && x.big().Cmp(y.big()) == 0
+	case *Rat:
+		y, ok := b.(*Rat)
+		return ok && x.big().Cmp(y.big()) == 0
+	}
+	return a == b
+}
 
-	return false
+// truth turns a Go bool into Bel's t or nil.
+func truth(b bool) Value {
+	if b {
+		return Intern("t")
+	}
+	return Nil
 }
 
-func isNil(i interface{}) bool {
+func isNil(i Value) bool {
 	return id(i, Nil)
 }
 
-func cons(car interface{}, cdr interface{}) *Pair {
+func cons(car Value, cdr Value) *Pair {
 	return &Pair{car, cdr}
 }
 
-func car(p *Pair) interface{} {
+func car(p *Pair) Value {
+	if p == Nil {
+		return Nil
+	}
 	return p.First
 }
 
-func cdr(p *Pair) interface{} {
+func cdr(p *Pair) Value {
+	if p == Nil {
+		return Nil
+	}
 	return p.Rest
 }
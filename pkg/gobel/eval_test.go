@@ -8,13 +8,13 @@ import (
 func TestEval(t *testing.T) {
 	emptyEnv := NewEnv(nil)
 	oneEnv := NewEnv(nil)
-	oneEnv.set("one", 1)
+	oneEnv.set("one", Int(1))
 
 	t.Run("types", func(t *testing.T) {
 		cases := []evalCase{
-			{"integer", []interface{}{1}, emptyEnv, 1},
-			{"symbol", []interface{}{&Symbol{"one"}}, oneEnv, 1},
-			{"multiple expressions", Read("1 2 3"), GlobalEnv(), 3},
+			{"integer", []Value{Int(1)}, emptyEnv, Int(1)},
+			{"symbol", []Value{Intern("one")}, oneEnv, Int(1)},
+			{"multiple expressions", Read("1 2 3"), GlobalEnv(), Int(3)},
 		}
 
 		testEvalCases(cases, t)
@@ -22,10 +22,10 @@ func TestEval(t *testing.T) {
 
 	t.Run("addition", func(t *testing.T) {
 		cases := []evalCase{
-			{"addition", []interface{}{&Pair{&Symbol{"+"}, &Pair{1, &Pair{2, Nil}}}}, GlobalEnv(), 3},
-			{"more addition", Read("(+ 1 2 3 4 5)"), GlobalEnv(), 15},
-			{"empty addition", Read("(+)"), GlobalEnv(), 0},
-			{"nested addition", Read("(+ (+ 2 2) (+ 3 3))"), GlobalEnv(), 10},
+			{"addition", []Value{&Pair{Intern("+"), &Pair{Int(1), &Pair{Int(2), Nil}}}}, GlobalEnv(), Int(3)},
+			{"more addition", Read("(+ 1 2 3 4 5)"), GlobalEnv(), Int(15)},
+			{"empty addition", Read("(+)"), GlobalEnv(), Int(0)},
+			{"nested addition", Read("(+ (+ 2 2) (+ 3 3))"), GlobalEnv(), Int(10)},
 		}
 
 		testEvalCases(cases, t)
@@ -33,80 +33,310 @@ func TestEval(t *testing.T) {
 
 	t.Run("subtraction", func(t *testing.T) {
 		cases := []evalCase{
-			{"subtract", Read("(-)"), GlobalEnv(), 0},
-			{"subtract", Read("(- 1)"), GlobalEnv(), -1},
-			{"subtract", Read("(- 6 4)"), GlobalEnv(), 2},
-			{"subtract", Read("(- 20 2 2 2)"), GlobalEnv(), 14},
-			{"subtract", Read("(- 20 (+ 2 2 2) (- 10))"), GlobalEnv(), 24},
+			{"subtract", Read("(-)"), GlobalEnv(), Int(0)},
+			{"subtract", Read("(- 1)"), GlobalEnv(), Int(-1)},
+			{"subtract", Read("(- 6 4)"), GlobalEnv(), Int(2)},
+			{"subtract", Read("(- 20 2 2 2)"), GlobalEnv(), Int(14)},
+			{"subtract", Read("(- 20 (+ 2 2 2) (- 10))"), GlobalEnv(), Int(24)},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("numbers", func(t *testing.T) {
+		cases := []evalCase{
+			{"big number", Read("(- 1 (expt 2 100))"), GlobalEnv(), bigInt("-1267650600228229401496703205375")},
+			{"addition overflows into a big number", Read("(+ 9223372036854775807 1)"), GlobalEnv(), bigInt("9223372036854775808")},
+			{"subtraction overflows into a big number", Read("(- -9223372036854775808 1)"), GlobalEnv(), bigInt("-9223372036854775809")},
+			{"multiplication overflows into a big number", Read("(* 4611686018427387904 4)"), GlobalEnv(), bigInt("18446744073709551616")},
+			{"big numbers shrink back", Read("(- (+ 9223372036854775807 1) 1)"), GlobalEnv(), Int(9223372036854775807)},
+			{"ratio", Read("1/3"), GlobalEnv(), rat(1, 3)},
+			{"division", Read("(/ 1 3)"), GlobalEnv(), rat(1, 3)},
+			{"reciprocal", Read("(/ 4)"), GlobalEnv(), rat(1, 4)},
+			{"exact division", Read("(/ 12 3 2)"), GlobalEnv(), Int(2)},
+			{"ratios add up", Read("(+ 1/3 2/3)"), GlobalEnv(), Int(1)},
+			{"multiplication", Read("(* 2 3 4)"), GlobalEnv(), Int(24)},
+			{"empty multiplication", Read("(*)"), GlobalEnv(), Int(1)},
+			{"negative power", Read("(expt 2 -2)"), GlobalEnv(), rat(1, 4)},
+			{"power of a ratio", Read("(expt 2/3 2)"), GlobalEnv(), rat(4, 9)},
 		}
 		testEvalCases(cases, t)
 	})
 
 	t.Run("if", func(t *testing.T) {
 		cases := []evalCase{
-			{"if true", Read("(if 1 6 7)"), GlobalEnv(), 6},
-			{"if nil", Read("(if nil 6 7)"), GlobalEnv(), 7},
-			{"do not eval third if true", Read("(if 1 6 garbage)"), GlobalEnv(), 6},
-			{"do not eval second if false", Read("(if nil rubbish 7)"), GlobalEnv(), 7},
-			{"bel if", Read("(if nil rubbish nil more-rubbish 7 )"), GlobalEnv(), 7},
+			{"if true", Read("(if 1 6 7)"), GlobalEnv(), Int(6)},
+			{"if nil", Read("(if nil 6 7)"), GlobalEnv(), Int(7)},
+			{"do not eval third if true", Read("(if 1 6 garbage)"), GlobalEnv(), Int(6)},
+			{"do not eval second if false", Read("(if nil rubbish 7)"), GlobalEnv(), Int(7)},
+			{"bel if", Read("(if nil rubbish nil more-rubbish 7 )"), GlobalEnv(), Int(7)},
 			{"bel if shortened", Read("(if nil rubbish)"), GlobalEnv(), Nil},
 			{"bel if bit longer", Read("(if nil rubbish nil balls nil crap)"), GlobalEnv(), Nil},
+			{"else branch is evaluated", Read("(if nil 1 (+ 1 1))"), GlobalEnv(), Int(2)},
 		}
 		testEvalCases(cases, t)
 	})
 
 	t.Run("quote", func(t *testing.T) {
 		cases := []evalCase{
-			{"quote", Read("(quote a)"), GlobalEnv(), &Symbol{"a"}},
+			{"quote", Read("(quote a)"), GlobalEnv(), Intern("a")},
 		}
 		testEvalCases(cases, t)
 	})
 
 	t.Run("set", func(t *testing.T) {
 		cases := []evalCase{
-			{"simple set", Read("(set x 1) x"), GlobalEnv(), 1},
-			{"fancy quote set", Read("(set x 55) x"), GlobalEnv(), 55},
+			{"simple set", Read("(set x 1) x"), GlobalEnv(), Int(1)},
+			{"fancy quote set", Read("(set x 55) x"), GlobalEnv(), Int(55)},
+			{"an enclosing binding", Read("(set x 1) ((lambda () (set x 2))) x"), GlobalEnv(), Int(2)},
+			{"a parameter", Read("((lambda (x) (set x 2) x) 1)"), GlobalEnv(), Int(2)},
+			{"an unbound name from inside a function", Read("((lambda () (set y 3))) y"), GlobalEnv(), Int(3)},
 		}
 		testEvalCases(cases, t)
 	})
 
 	t.Run("a simple procedure", func(t *testing.T) {
 		cases := []evalCase{
-			{"test-procedure", Read("(test-procedure 1 1)"), GlobalEnv(), 2},
+			{"test-procedure", Read("(test-procedure 1 1)"), GlobalEnv(), Int(2)},
 		}
 		testEvalCases(cases, t)
 	})
 
 	t.Run("lambda", func(t *testing.T) {
 		cases := []evalCase{
-			{"lambda", Read("((lambda (x) x) 1)"), GlobalEnv(), 1},
-			{"lambda lambda", Read("((lambda (x) (+ x x)) 1)"), GlobalEnv(), 2},
-			{"lambda the ultimate", Read("((lambda (x y) (+ x y)) 3 4)"), GlobalEnv(), 7},
+			{"lambda", Read("((lambda (x) x) 1)"), GlobalEnv(), Int(1)},
+			{"lambda lambda", Read("((lambda (x) (+ x x)) 1)"), GlobalEnv(), Int(2)},
+			{"lambda the ultimate", Read("((lambda (x y) (+ x y)) 3 4)"), GlobalEnv(), Int(7)},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("fn", func(t *testing.T) {
+		cases := []evalCase{
+			{"fn", Read("((fn (x) (+ x 1)) 1)"), GlobalEnv(), Int(2)},
+			{"bracket fn", Read("([+ _ 1] 2)"), GlobalEnv(), Int(3)},
+			{"nested bracket fns", Read("([_ 3] [+ _ 1])"), GlobalEnv(), Int(4)},
 		}
 		testEvalCases(cases, t)
 	})
 
 	t.Run("define", func(t *testing.T) {
 		cases := []evalCase{
-			{"define double", Read("(define double (x) (+ x x)) (double 4)"), GlobalEnv(), 8},
+			{"define double", Read("(define double (x) (+ x x)) (double 4)"), GlobalEnv(), Int(8)},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("id", func(t *testing.T) {
+		cases := []evalCase{
+			{"same symbol", Read("(id 'a 'a)"), GlobalEnv(), Intern("t")},
+			{"different symbols", Read("(id 'a 'b)"), GlobalEnv(), Nil},
+			{"same character", Read(`(id \a \a)`), GlobalEnv(), Intern("t")},
+			{"same integer", Read("(id 1 1)"), GlobalEnv(), Intern("t")},
+			{"different integers", Read("(id 1 2)"), GlobalEnv(), Nil},
+			{"same big integer", Read("(id (expt 2 100) (expt 2 100))"), GlobalEnv(), Intern("t")},
+			{"different big integers", Read("(id (expt 2 100) (expt 2 101))"), GlobalEnv(), Nil},
+			{"same ratio", Read("(id 1/3 (/ 2 6))"), GlobalEnv(), Intern("t")},
+			{"different ratios", Read("(id 1/3 2/3)"), GlobalEnv(), Nil},
+			{"equal lists", Read("(id '(a) '(a))"), GlobalEnv(), Nil},
+			{"same list", Read("(set x '(a)) (id x x)"), GlobalEnv(), Intern("t")},
+			{"nil", Read("(id nil ())"), GlobalEnv(), Intern("t")},
+			{"symbol and character", Read(`(id 'a \a)`), GlobalEnv(), Nil},
 		}
+
 		testEvalCases(cases, t)
 	})
 
 	t.Run("cons", func(t *testing.T) {
 		cases := []evalCase{
-			{"cons", Read("(cons 1 1)"), GlobalEnv(), &Pair{1, 1}},
-			{"cons", Read("(cons 1 (cons 2 nil))"), GlobalEnv(), &Pair{1, &Pair{2, Nil}}},
+			{"cons", Read("(cons 1 1)"), GlobalEnv(), &Pair{Int(1), Int(1)}},
+			{"cons", Read("(cons 1 (cons 2 nil))"), GlobalEnv(), &Pair{Int(1), &Pair{Int(2), Nil}}},
 		}
 		testEvalCases(cases, t)
 	})
 
 	t.Run("list", func(t *testing.T) {
 		cases := []evalCase{
-			{"list", Read("(list 1 2 3)"), GlobalEnv(), &Pair{1, &Pair{2, &Pair{3, Nil}}}},
+			{"list", Read("(list 1 2 3)"), GlobalEnv(), &Pair{Int(1), &Pair{Int(2), &Pair{Int(3), Nil}}}},
 		}
 		testEvalCases(cases, t)
 	})
+
+	t.Run("bquote", func(t *testing.T) {
+		cases := []evalCase{
+			{"no commas", Read("`(a b)"), GlobalEnv(), Read("(a b)")[0]},
+			{"atom", Read("`a"), GlobalEnv(), Intern("a")},
+			{"comma", Read("`(a ,(+ 1 2))"), GlobalEnv(), Read("(a 3)")[0]},
+			{"comma atom", Read("`,(+ 1 2)"), GlobalEnv(), Int(3)},
+			{"comma in dotted tail", Read("`(a . ,(+ 1 2))"), GlobalEnv(), Read("(a . 3)")[0]},
+			{"splice", Read("`(a ,@(list 1 2))"), GlobalEnv(), Read("(a 1 2)")[0]},
+			{"splice in the middle", Read("`(a ,@(list 1 2) b)"), GlobalEnv(), Read("(a 1 2 b)")[0]},
+			{"splice at the start", Read("`(,@(list 1 2) b)"), GlobalEnv(), Read("(1 2 b)")[0]},
+			{"splice nothing", Read("`(a ,@nil b)"), GlobalEnv(), Read("(a b)")[0]},
+			{"splice before a dotted tail", Read("`(a ,@(list 1 2) . b)"), GlobalEnv(), Read("(a 1 2 . b)")[0]},
+			{"splice as a dotted tail", Read("`(a . ,@(list 1 2))"), GlobalEnv(), Read("(a 1 . 2)")[0]},
+			{"splice does not share structure", Read("(set x (list 1 2)) (cdr (cdr `(,@x 3)))"), GlobalEnv(), Read("(3)")[0]},
+			{"nested", Read("`(a `(b ,(c ,(+ 1 2))))"), GlobalEnv(), Read("(a (bquote (b (comma (c 3)))))")[0]},
+			{"nested without inner commas", Read("`(a `(b ,c))"), GlobalEnv(), Read("(a (bquote (b (comma c))))")[0]},
+			{"nested splice", Read("(set x (list 1 2)) `(a `(b ,,@x))"), GlobalEnv(), Read("(a (bquote (b (comma 1 2))))")[0]},
+			{"double unquote", Read("(set x 1) (set y 'x) `(a `(b ,,y))"), GlobalEnv(), Read("(a (bquote (b (comma x))))")[0]},
+		}
+		testEvalCases(cases, t)
+	})
+}
+
+func TestEvalMisuse(t *testing.T) {
+	cases := []struct {
+		name    string
+		program string
+	}{
+		{"adding a symbol", "(+ 1 'a)"},
+		{"subtracting from a character", `(- \a 1)`},
+		{"dividing a list", "(/ '(1) 2)"},
+		{"a dotted call", "(+ 1 . 2)"},
+		{"a dotted special form", "(if t . 1)"},
+		{"calling a number", "(1 2)"},
+		{"calling a string", `("a" 1)`},
+		{"power of a symbol", "(expt 'a 2)"},
+		{"set with nothing to set", "(set)"},
+		{"define with nothing to define", "(define)"},
+		{"define without parameters", "(define f)"},
+		{"defining a quoted name", "(define 'a)"},
+		{"lambda without parameters", "(lambda)"},
+		{"macro without parameters", "(macro)"},
+		{"expt without arguments", "(expt)"},
+		{"expt without a power", "(expt 2)"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Eval(Read(c.program), GlobalEnv())
+			if _, ok := err.(*BelError); !ok {
+				t.Fatalf("Expected an error from %s but got %v", c.program, got)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	t.Run("kinds", func(t *testing.T) {
+		cases := []struct {
+			program string
+			kind    ErrorKind
+		}{
+			{"nope", UnboundError},
+			{"((fn (a b) a) 1)", ArityError},
+			{"((fn (a) a) 1 2)", ArityError},
+			{"(car 'a)", TypeError},
+			{"(+ 1 'a)", TypeError},
+			{"('a 1)", NotCallableError},
+			{"(/ 1 0)", OtherError},
+		}
+		for _, c := range cases {
+			t.Run(c.program, func(t *testing.T) {
+				_, err := Eval(Read(c.program), GlobalEnv())
+				if e, ok := err.(*BelError); !ok || e.Kind != c.kind {
+					t.Errorf("Expected a %s error but got %#v", c.kind, err)
+				}
+			})
+		}
+	})
+
+	t.Run("stack", func(t *testing.T) {
+		_, err := Eval(Read("(def f (x) (+ 1 (car x))) (def g (x) (f x)) (list (g 'a))"), GlobalEnv())
+		e, ok := err.(*BelError)
+		if !ok {
+			t.Fatalf("Expected a *BelError but got %#v", err)
+		}
+		want := Read("(car x) (+ 1 (car x)) (f x) (g 'a) (list (g 'a))")
+		if !reflect.DeepEqual(want, e.Stack) {
+			t.Errorf("Expected the stack %v but got %v", want, e.Stack)
+		}
+		if got, want := e.StackTrace(), "type error: car-on-atom: a\n  in (car x)\n  in (+ 1 (car x))\n  in (f x)\n  in (g (quote a))\n  in (list (g (quote a)))"; got != want {
+			t.Errorf("Expected the trace\n%s\nbut got\n%s", want, got)
+		}
+	})
+
+	t.Run("stack of an error with no kind", func(t *testing.T) {
+		_, err := Eval(Read("(def f (x) (/ x 0)) (f 1)"), GlobalEnv())
+		e, ok := err.(*BelError)
+		if !ok {
+			t.Fatalf("Expected a *BelError but got %#v", err)
+		}
+		if got, want := e.StackTrace(), "error: division by zero\n  in (/ x 0)\n  in (f 1)"; got != want {
+			t.Errorf("Expected the trace\n%s\nbut got\n%s", want, got)
+		}
+	})
+
+	t.Run("failures stop evaluation", func(t *testing.T) {
+		env := GlobalEnv()
+		cases := []string{
+			"(set x 1) (car 'a) (set x 2)",
+			"(set y (car 'a))",
+			"(list (set x 3) (car 'a) (set x 4))",
+			"((fn (a) (set x 5)) (car 'a))",
+			"(if (car 'a) (set x 6) (set x 7))",
+		}
+		for _, program := range cases {
+			if got, err := Eval(Read(program), env); err == nil {
+				t.Fatalf("Expected an error from %s but got %v", program, got)
+			}
+		}
+		if got, _ := Eval(Read("x"), env); got != Int(3) {
+			t.Errorf("Expected x to be 3 but got %v", got)
+		}
+		if _, err := Eval(Read("y"), env); err == nil {
+			t.Errorf("Expected y not to be bound")
+		}
+	})
+}
+
+func TestTailCalls(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loops ten million times")
+	}
+	env := GlobalEnv()
+	_, err := Eval(Read(`
+(def count-down (n)
+  (if (id n 0) 'done
+    (count-down (- n 1))))
+
+(def even (n)
+  (if (id n 0) t (odd (- n 1))))
+
+(def odd (n)
+  (if (id n 0) nil (even (- n 1))))
+
+(def count-with-let (n)
+  (let m (- n 1)
+    (if (id m 0) 'done (count-with-let m))))
+
+(def count-with-apply (n)
+  (if (id n 0) 'done (apply count-with-apply (join (- n 1) nil))))
+`), env)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cases := []evalCase{
+		{"ten million calls", Read("(count-down 10000000)"), env, Intern("done")},
+		{"mutual recursion", Read("(even 1000001)"), env, Nil},
+		{"through a macro", Read("(count-with-let 300000)"), env, Intern("done")},
+		{"through apply", Read("(count-with-apply 1000000)"), env, Intern("done")},
+	}
+	testEvalCases(cases, t)
+
+	t.Run("errors report the latest tail calls", func(t *testing.T) {
+		_, err := Eval(Read("(def f (n) (if (id n 0) (car n) (f (- n 1)))) (f 100)"), env)
+		e, ok := err.(*BelError)
+		if !ok {
+			t.Fatalf("Expected a *BelError but got %#v", err)
+		}
+		if len(e.Stack) != maxTails+1 {
+			t.Errorf("Expected %d calls on the stack but got %d", maxTails+1, len(e.Stack))
+		}
+		if want := Read("(f (- n 1))")[0]; !reflect.DeepEqual(want, e.Stack[1]) {
+			t.Errorf("Expected %v under the failing call but got %v", want, e.Stack[1])
+		}
+	})
 }
 
 func testEvalCases(cases []evalCase, t *testing.T) {
@@ -114,7 +344,10 @@ func testEvalCases(cases []evalCase, t *testing.T) {
 	for i := range cases {
 		c := cases[i]
 		t.Run(c.name, func(t *testing.T) {
-			got := Eval(c.expression, c.env)
+			got, err := Eval(c.expression, c.env)
+			if err != nil {
+				t.Fatalf("Unexpected error evaluating %v: %v", c.expression[0], err)
+			}
 			if !reflect.DeepEqual(got, c.want) {
 				t.Fatalf("Expected %v to evaluate to %v but got %+v", c.expression[0], c.want, got)
 			}
@@ -124,7 +357,7 @@ func testEvalCases(cases []evalCase, t *testing.T) {
 
 type evalCase struct {
 	name       string
-	expression []interface{}
+	expression []Value
 	env        *Env
-	want       interface{}
+	want       Value
 }
@@ -0,0 +1,175 @@
+package gobel
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// bodyForms are the operators whose last arguments are a body. The number is
+// how many arguments come before the body. Those are indented further if they
+// start a line, so that they stand out from the body.
+var bodyForms = map[string]int{
+	"lambda": 1,
+	"fn":     1,
+	"macro":  1,
+	"define": 2,
+	"def":    2,
+	"mac":    2,
+	"let":    2,
+	"with":   1,
+	"if":     1,
+	"when":   1,
+	"unless": 1,
+	"do":     0,
+	"case":   1,
+	"catch":  0,
+	"on-err": 1,
+	"each":   2,
+	"while":  1,
+}
+
+// bodyIndent is how far the body of a form is indented from its opening bracket.
+const bodyIndent = 2
+
+// Format lays out Bel source in the canonical style. Line breaks stay where
+// they were written, but each line is re-indented with the usual Lisp rules:
+//
+//   - the body of a special form is indented two spaces from its opening bracket
+//   - the arguments of any other call line up with the first argument, if that
+//     is on the same line as the operator
+//   - anything else lines up with the first element of its list
+//
+// Comments are kept, runs of blank lines are squeezed into one, and closing
+// brackets are pulled up onto the end of the line before them.
+func Format(filename string, src []byte) ([]byte, error) {
+	tree, err := ParseSyntax(filename, string(src))
+	if err != nil {
+		return nil, err
+	}
+	f := &formatter{}
+	f.file(tree)
+	return []byte(f.out.String()), nil
+}
+
+type formatter struct {
+	out strings.Builder
+	col int
+}
+
+func (f *formatter) write(s string) {
+	f.out.WriteString(s)
+	if i := strings.LastIndexByte(s, '\n'); i != -1 {
+		f.col = utf8.RuneCountInString(s[i+1:])
+	} else {
+		f.col += utf8.RuneCountInString(s)
+	}
+}
+
+func (f *formatter) newlines(n, indent int) {
+	f.write(strings.Repeat("\n", n) + strings.Repeat(" ", indent))
+}
+
+// lineBreaks counts the line breaks in the space before a node, allowing for
+// one blank line at most.
+func lineBreaks(space string) int {
+	n := strings.Count(space, "\n")
+	if n > 2 {
+		return 2
+	}
+	return n
+}
+
+func (f *formatter) file(tree *Syntax) {
+	for i, c := range tree.Children {
+		if i > 0 {
+			if n := lineBreaks(c.Space); n > 0 {
+				f.newlines(n, 0)
+			} else {
+				f.write(" ")
+			}
+		}
+		f.node(c)
+	}
+	if len(tree.Children) > 0 {
+		f.write("\n")
+	}
+}
+
+func (f *formatter) node(n *Syntax) {
+	switch n.Kind {
+	case SyntaxList:
+		f.list(n)
+	case SyntaxPrefix:
+		indent := f.col
+		f.write(n.Text)
+		for i, c := range n.Children {
+			if b := lineBreaks(c.Space); b > 0 {
+				f.newlines(b, indent)
+			} else if i > 0 || c.Kind == SyntaxComment {
+				f.write(" ")
+			}
+			f.node(c)
+		}
+	default:
+		f.write(n.Text)
+	}
+}
+
+func (f *formatter) list(n *Syntax) {
+	open := f.col
+	f.write(n.Text)
+
+	var head *Syntax
+	arg := 0 // how many non-comment children have been written so far
+	argCol := -1
+	for i, c := range n.Children {
+		if b := lineBreaks(c.Space); b > 0 {
+			f.newlines(b, f.indent(open, head, arg, argCol))
+		} else if i > 0 {
+			f.write(" ")
+		}
+		if c.Kind == SyntaxComment {
+			f.node(c)
+			continue
+		}
+		if arg == 0 {
+			head = c
+		} else if arg == 1 && lineBreaks(c.Space) == 0 {
+			argCol = f.col
+		}
+		f.node(c)
+		arg++
+	}
+
+	if last := len(n.Children) - 1; last >= 0 && n.Children[last].IsLineComment() {
+		f.newlines(1, open+1)
+	}
+	f.write(n.Close)
+}
+
+// isSymbolText reports whether an atom as written is a symbol, rather than a
+// number, character or label.
+func isSymbolText(s string) bool {
+	if _, ok, _ := parseNumber(s); ok {
+		return false
+	}
+	return !strings.HasPrefix(s, `\`) && !strings.HasPrefix(s, "#")
+}
+
+// indent works out where to start a line in a list opened at column open,
+// given its head and the number of elements before the line.
+func (f *formatter) indent(open int, head *Syntax, arg, argCol int) int {
+	if head == nil || head.Kind != SyntaxAtom || !isSymbolText(head.Text) {
+		return open + 1
+	}
+	if distinguished, ok := bodyForms[head.Text]; ok {
+		if arg <= distinguished {
+			return open + 2*bodyIndent
+		}
+		return open + bodyIndent
+	}
+	if argCol != -1 {
+		return argCol
+	}
+	return open + 1
+}
@@ -0,0 +1,68 @@
+package gobel
+
+import (
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"empty", "", ""},
+		{"adds a final newline", "(a b)", "(a b)\n"},
+		{"squeezes spaces", "(a   b\tc )", "(a b c)\n"},
+		{"keeps forms on one line", "a b", "a b\n"},
+		{"squeezes blank lines", "\n\n(a)\n\n\n\n(b)\n\n", "(a)\n\n(b)\n"},
+		{"aligns arguments", "(foo a\nb\n   c)", "(foo a\n     b\n     c)\n"},
+		{"indents arguments after the operator", "(foo\na b)", "(foo\n a b)\n"},
+		{"aligns data", "((a b)\nc)", "((a b)\n c)\n"},
+		{"aligns numbers", "(1 2\n3)", "(1 2\n 3)\n"},
+		{"indents bodies", "(lambda (x)\n(+ x 1))", "(lambda (x)\n  (+ x 1))\n"},
+		{"indents distinguished arguments further", "(define f\n(x)\nx)", "(define f\n    (x)\n  x)\n"},
+		{"indents if", "(if a\nb\n     c)", "(if a\n  b\n  c)\n"},
+		{"nests", "(def f (x)\n(let y 1\n(+ x\ny)))", "(def f (x)\n  (let y 1\n    (+ x\n       y)))\n"},
+		{"pulls up closing brackets", "(a\n b\n )\n", "(a\n b)\n"},
+		{"keeps comments", "; top\n(a ; one\n b) ; two\n", "; top\n(a ; one\n b) ; two\n"},
+		{"closes after a comment on the next line", "(a\n b ; two\n)", "(a\n b ; two\n )\n"},
+		{"keeps block comments", "#| a\n  b |#\n(c)", "#| a\n  b |#\n(c)\n"},
+		{"indents quoted lists", "'(a\nb)", "'(a\n  b)\n"},
+		{"indents brackets", "[f _\nx]", "[f _\n   x]\n"},
+		{"keeps strings", "(a \"b\n  c\"\nd)", "(a \"b\n  c\"\n   d)\n"},
+		{"keeps spelling", "(a \\sp 3/4 #1=(b) #1#)", "(a \\sp 3/4 #1=(b) #1#)\n"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Format("test.bel", []byte(c.src))
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if string(got) != c.want {
+				t.Errorf("Expected\n%s\nbut got\n%s", c.want, got)
+			}
+			again, err := Format("test.bel", got)
+			if err != nil || string(again) != string(got) {
+				t.Errorf("Expected formatting to be stable but got\n%s", again)
+			}
+		})
+	}
+
+	t.Run("reports syntax errors", func(t *testing.T) {
+		if _, err := Format("test.bel", []byte("(a")); err == nil {
+			t.Errorf("Expected an error")
+		}
+	})
+
+	t.Run("rejects whatever Read rejects", func(t *testing.T) {
+		for _, src := range []string{`(a \*b)`, "(a {b c})", "(a . b c)", "#1#"} {
+			if _, err := Parse("test.bel", src); err == nil {
+				t.Fatalf("Expected Read to reject %q", src)
+			}
+			if got, err := Format("test.bel", []byte(src)); err == nil {
+				t.Errorf("Expected an error formatting %q but got %q", src, got)
+			}
+		}
+	})
+}
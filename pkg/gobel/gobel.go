@@ -2,8 +2,12 @@ package gobel
 
 import (
 	"container/list"
-	"strconv"
+	"errors"
+	"fmt"
+	"io"
 	"strings"
+	"sync"
+	"text/scanner"
 )
 
 type List struct {
@@ -11,124 +15,393 @@ type List struct {
 }
 
 type Pair struct {
-	First interface{}
-	Rest  interface{}
+	First Value
+	Rest  Value
 }
 
+// Symbol is a Bel symbol. Symbols can only be made by Intern, so that there is
+// only ever one *Symbol with a given name and they can be compared with ==.
 type Symbol struct {
-	Str string
+	name string
+}
+
+// Name returns the name of s.
+func (s *Symbol) Name() string {
+	return s.name
+}
+
+// symbols is the symbol table that Intern looks names up in.
+var symbols = struct {
+	sync.RWMutex
+	table map[string]*Symbol
+}{table: make(map[string]*Symbol)}
+
+// Intern returns the symbol called name, making it the first time it's asked
+// for.
+func Intern(name string) *Symbol {
+	symbols.RLock()
+	s, ok := symbols.table[name]
+	symbols.RUnlock()
+	if ok {
+		return s
+	}
+	symbols.Lock()
+	defer symbols.Unlock()
+	s, ok = symbols.table[name]
+	if !ok {
+		s = &Symbol{name}
+		symbols.table[name] = s
+	}
+	return s
 }
 
 // Nil is a more Lispy nil than `nil` - it's a nil *Pair.
 var Nil *Pair = nil
 
 // Lexer describes a simple lexer for the Bel language. It can return the current token
-// as a string, move to the next token, and flag when the input is at an end.
+// as a string, move to the next token, and flag when the input is at an end. It also
+// reports where the current token starts and any error it ran into along the way.
 type Lexer interface {
 	Current() string
 	Next()
 	End() bool
+	Pos() scanner.Position
+	Err() error
 }
 
-func Read(program string) []interface{} {
-	var expressions []interface{}
-	toks := NewScanLexer(strings.NewReader(program))
-	for !toks.End() {
-		e := readTokens(toks)
-		expressions = append(expressions, e)
+// ParseError describes malformed input: where it was found and the token that
+// the reader choked on.
+type ParseError struct {
+	Pos   scanner.Position
+	Token string
+	Msg   string
+}
+
+func (e *ParseError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
 	}
+	return fmt.Sprintf("%s: %s near %q", e.Pos, e.Msg, e.Token)
+}
+
+// Read reads every expression in program. It gives up quietly at the first
+// syntax error; use Parse to find out what went wrong.
+func Read(program string) []Value {
+	expressions, _ := Parse("", program)
 	return expressions
 }
 
-func readTokens(toks Lexer) interface{} {
-	if toks.Current() == "'" {
-		toks.Next()
-		return &Pair{&Symbol{"quote"}, &Pair{readTokens(toks), Nil}}
+// Parse reads every expression in program, stopping at the first syntax error.
+// The error is always a *ParseError, with filename used to report its position.
+func Parse(filename, program string) ([]Value, error) {
+	var expressions []Value
+	r := NewReader(strings.NewReader(program))
+	r.Filename = filename
+	for {
+		e, err := r.ReadExpr()
+		if err == io.EOF {
+			return expressions, nil
+		}
+		if err != nil {
+			return expressions, err
+		}
+		expressions = append(expressions, e)
+	}
+}
+
+// Reader reads Bel expressions one at a time from an underlying io.Reader.
+type Reader struct {
+	// Filename is used when reporting the position of a *ParseError.
+	Filename string
+	// Readtable says how to read each token. Add to it to read new syntax.
+	Readtable *Readtable
+	toks      Lexer
+	// labels holds the expressions labelled with #n= in the expression being
+	// read, so that #n# can refer back to them.
+	labels map[string]Value
+}
+
+// NewReader returns a Reader that splits r into tokens with a BelLexer.
+func NewReader(r io.Reader) *Reader {
+	return NewLexerReader(NewBelLexer(r))
+}
+
+// NewLexerReader returns a Reader that reads the tokens toks gives it.
+func NewLexerReader(toks Lexer) *Reader {
+	return &Reader{toks: toks, Readtable: NewReadtable()}
+}
+
+// ReadExpr reads the next complete expression, blocking until it has been
+// closed. It returns io.EOF once the input runs out between expressions, and a
+// *ParseError for anything malformed, including input that stops part way
+// through an expression. After a *ParseError the token that caused it has
+// been skipped, so the next call carries on with the rest of the input.
+func (r *Reader) ReadExpr() (Value, error) {
+	if err := r.skipDatumComments(); err != nil {
+		return nil, r.recover(err)
+	}
+	if r.toks.End() {
+		return nil, io.EOF
+	}
+	r.labels = nil
+	e, err := r.readTokens()
+	if err != nil {
+		return nil, r.recover(err)
+	}
+	return e, nil
+}
+
+// recover moves the reader past the token that caused err, which would
+// otherwise stop every later read in the same place, and fills in the
+// filename.
+func (r *Reader) recover(err *ParseError) *ParseError {
+	if !r.toks.End() {
+		r.toks.Next()
+	}
+	err.Pos.Filename = r.Filename
+	return err
+}
+
+func parseError(toks Lexer, msg string) *ParseError {
+	token := toks.Current()
+	if toks.End() {
+		token = ""
+	}
+	return &ParseError{Pos: toks.Pos(), Token: token, Msg: msg}
+}
+
+// lexError turns anything the lexer complained about when reading the current
+// token into a *ParseError.
+func lexError(toks Lexer) *ParseError {
+	if err := toks.Err(); err != nil {
+		return parseError(toks, err.Error())
 	}
-	if toks.Current() == "(" {
+	return nil
+}
+
+// skipDatumComments reads and throws away any expressions commented out with
+// #;, leaving the lexer on the first token that isn't part of one.
+func (r *Reader) skipDatumComments() *ParseError {
+	toks := r.toks
+	for {
+		if err := lexError(toks); err != nil {
+			return err
+		}
+		if toks.End() || toks.Current() != "#;" {
+			return nil
+		}
 		toks.Next()
-		return readList(toks)
+		if _, err := r.readTokens(); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Reader) readTokens() (Value, *ParseError) {
+	toks := r.toks
+	if err := r.skipDatumComments(); err != nil {
+		return nil, err
+	}
+	if toks.End() {
+		return nil, parseError(toks, "unexpected end of input")
+	}
+	if toks.Current() == "." {
+		return nil, parseError(toks, "unexpected .")
+	}
+	if v, err, ok := r.readMacro(); ok {
+		return v, err
 	}
-	if strings.HasPrefix(toks.Current(), `"`) {
-		s := aString(toks.Current())
+	a, err := atom(toks.Current())
+	if err != nil {
+		return nil, parseError(toks, err.Error())
+	}
+	toks.Next()
+	return a, nil
+}
+
+// isLabel reports whether tok is a datum label, #n= or #n#.
+func isLabel(tok string) bool {
+	return len(tok) > 1 && tok[0] == '#' && isDigits(tok[1:2])
+}
+
+// placeholder stands in for a labelled expression until it has been read. It
+// holds the label's name so that it isn't zero-sized, as Go may give every
+// pointer to a zero-sized value the same address, and each label needs a
+// placeholder that is different from every other.
+type placeholder struct {
+	name string
+}
+
+func (*placeholder) isValue()       {}
+func (*placeholder) Type() *Symbol  { return Intern("placeholder") }
+func (*placeholder) String() string { return "#[placeholder]" }
+
+// readLabel reads #n=, which labels the expression that follows it, and #n#,
+// which refers back to that expression. References from inside an expression
+// to its own label are patched up once it has been read, so that the
+// expression can contain itself.
+func (r *Reader) readLabel() (Value, *ParseError) {
+	toks := r.toks
+	tok := toks.Current()
+	name, kind := tok[1:len(tok)-1], tok[len(tok)-1]
+	if !isDigits(name) || (kind != '=' && kind != '#') {
+		return nil, parseError(toks, "bad label")
+	}
+
+	if kind == '#' {
+		e, ok := r.labels[name]
+		if !ok {
+			return nil, parseError(toks, "undefined label")
+		}
 		toks.Next()
-		return s
+		return e, nil
+	}
+
+	if _, ok := r.labels[name]; ok {
+		return nil, parseError(toks, "label defined twice")
 	}
-	a := atom(toks.Current())
+	if r.labels == nil {
+		r.labels = make(map[string]Value)
+	}
+	ph := &placeholder{name}
+	r.labels[name] = ph
 	toks.Next()
-	return a
-}
-
-func aString(str string) *Pair {
-	str = strings.TrimPrefix(str, `"`)
-	str = strings.TrimSuffix(str, `"`)
-	rs := []rune(str)
-	p := Nil
-	for i := len(str) - 1; i > -1; i-- {
-		p = cons(rs[i], p)
-		if rs[i] == '"' || rs[i] == '\\' { // jump past the escape character when reading in
-			i--
+	e, err := r.readTokens()
+	if err != nil {
+		return nil, err
+	}
+	if e == ph {
+		return nil, parseError(toks, "label refers only to itself")
+	}
+	r.labels[name] = e
+	replacePlaceholder(e, ph, e, make(map[Value]bool))
+	return e, nil
+}
+
+// replacePlaceholder replaces every reference to ph in e with v. Only the
+// values in a table are looked at, as changing a key would change its hash.
+func replacePlaceholder(e Value, ph *placeholder, v Value, seen map[Value]bool) {
+	if t, ok := e.(*Table); ok && !seen[t] {
+		seen[t] = true
+		for i := range t.entries {
+			if t.entries[i].value == ph {
+				t.entries[i].value = v
+			} else {
+				replacePlaceholder(t.entries[i].value, ph, v, seen)
+			}
+		}
+		return
+	}
+	for p, ok := e.(*Pair); ok && p != Nil && !seen[p]; p, ok = p.Rest.(*Pair) {
+		seen[p] = true
+		if p.First == ph {
+			p.First = v
+		} else {
+			replacePlaceholder(p.First, ph, v, seen)
+		}
+		if p.Rest == ph {
+			p.Rest = v
 		}
 	}
-	return p
 }
 
-func readList(toks Lexer) *Pair {
+func aString(str string) (*Pair, error) {
+	if len(str) < 2 || !strings.HasSuffix(str, `"`) {
+		return nil, errors.New("unterminated string")
+	}
+	var rs []rune
+	escaped := false
+	for _, r := range str[1 : len(str)-1] {
+		if r == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		rs = append(rs, r)
+	}
+	if escaped {
+		return nil, errors.New("unterminated string")
+	}
+	return belString(string(rs)), nil
+}
+
+func (r *Reader) readList(closer string) (*Pair, *ParseError) {
+	toks := r.toks
+	if err := r.expectMore(closer); err != nil {
+		return nil, err
+	}
 	// () is an alias for Nil
-	if toks.Current() == ")" {
+	if toks.Current() == closer {
 		toks.Next()
-		return Nil
+		return Nil, nil
 	}
 	head := Pair{}
 
-	head.First = readTokens(toks)
-	if toks.Current() == ")" {
+	first, err := r.readTokens()
+	if err != nil {
+		return nil, err
+	}
+	head.First = first
+
+	if err := r.expectMore(closer); err != nil {
+		return nil, err
+	}
+	switch toks.Current() {
+	case closer:
 		head.Rest = Nil
 		toks.Next()
-	} else if toks.Current() == "." {
+	case ".":
 		toks.Next()
-		head.Rest = readTokens(toks)
-	} else {
-		head.Rest = readList(toks)
+		rest, err := r.readTokens()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.expectMore(closer); err != nil {
+			return nil, err
+		}
+		if toks.Current() != closer {
+			return nil, parseError(toks, "expected "+closer+" after dotted tail")
+		}
+		head.Rest = rest
+		toks.Next()
+	default:
+		rest, err := r.readList(closer)
+		if err != nil {
+			return nil, err
+		}
+		head.Rest = rest
 	}
-	return &head
+	return &head, nil
 }
 
-func atom(a string) interface{} {
-	if a == "nil" {
-		return Nil
-	}
-	i, err := strconv.Atoi(a)
-	if err == nil {
-		return i
-	}
-	if a[0] == '\\' {
-		return charCodeLookup(a[1:])
-	}
-
-	return &Symbol{a}
+// bracketFn turns the body of a square bracket expression into the function
+// it stands for: [f _ x] is (fn (_) (f _ x)).
+func bracketFn(body *Pair) *Pair {
+	underscore := Intern("_")
+	return &Pair{Intern("fn"), &Pair{&Pair{underscore, Nil}, &Pair{body, Nil}}}
 }
 
-func charCodeLookup(s string) rune {
-	if len(s) == 1 {
-		// length is 1 so assume this is a direct mapping of rune to rune
-		// return the first rune in the string
-		for _, r := range s {
-			return r
-		}
+// expectMore checks that there is a good token to read before the end of a
+// list, and that the list isn't being closed with the wrong bracket.
+func (r *Reader) expectMore(closer string) *ParseError {
+	toks := r.toks
+	if err := r.skipDatumComments(); err != nil {
+		return err
 	}
-
-	if s == "bel" {
-		return '\a'
+	if toks.End() {
+		return parseError(toks, "unexpected end of input, expected "+closer)
 	}
-
-	if s == "space" {
-		return ' '
+	if c := toks.Current(); c != closer && (c == ")" || c == "]") {
+		return parseError(toks, "expected "+closer)
 	}
+	return nil
+}
 
-	if s == "tab" {
-		return '\t'
+// atom reads a token that no read macro wants, which makes it a number or a
+// symbol.
+func atom(a string) (Value, error) {
+	if n, ok, err := parseNumber(a); ok {
+		return n, err
 	}
-
-	return '\000'
+	return parseSymbol(a)
 }
@@ -1,17 +1,24 @@
 package gobel
 
 import (
+	"io"
+	"math/big"
 	"reflect"
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestRead(t *testing.T) {
 	t.Run("reader macros", func(t *testing.T) {
 		t.Run("quote", func(t *testing.T) {
 			cases := []readCase{
-				{"quote symbol", "'a", &Pair{&Symbol{"quote"}, &Pair{&Symbol{"a"}, Nil}}},
-				{"quote list", "'(1)", &Pair{&Symbol{"quote"}, &Pair{&Pair{1, Nil}, Nil}}},
+				{"quote symbol", "'a", &Pair{Intern("quote"), &Pair{Intern("a"), Nil}}},
+				{"quote list", "'(1)", &Pair{Intern("quote"), &Pair{&Pair{Int(1), Nil}, Nil}}},
+				{"bquote", "`a", &Pair{Intern("bquote"), &Pair{Intern("a"), Nil}}},
+				{"comma", ",a", &Pair{Intern("comma"), &Pair{Intern("a"), Nil}}},
+				{"comma-at", ",@a", &Pair{Intern("comma-at"), &Pair{Intern("a"), Nil}}},
+				{"nested", "`(a ,b ,@c)", Read("(bquote (a (comma b) (comma-at c)))")[0]},
 			}
 			testReadCases(cases, t)
 		})
@@ -19,34 +26,56 @@ func TestRead(t *testing.T) {
 
 	t.Run("numbers", func(t *testing.T) {
 		cases := []readCase{
-			{"integer", "1", 1},
+			{"integer", "1", Int(1)},
+			{"negative integer", "-1", Int(-1)},
+			{"big integer", "123456789012345678901234567890", bigInt("123456789012345678901234567890")},
+			{"ratio", "3/4", rat(3, 4)},
+			{"negative ratio", "-3/4", rat(-3, 4)},
+			{"ratio in lowest terms", "2/8", rat(1, 4)},
+			{"whole ratio", "6/3", Int(2)},
+			{"ratios in a list", "(1/2 3/4)", &Pair{rat(1, 2), &Pair{rat(3, 4), Nil}}},
 		}
 		testReadCases(cases, t)
 	})
 
 	t.Run("symbols", func(t *testing.T) {
 		cases := []readCase{
-			{"symbol", "symbol", &Symbol{"symbol"}},
+			{"symbol", "symbol", Intern("symbol")},
+			{"comparison", "<=", Intern("<=")},
+			{"earmuffs", "*foo*", Intern("*foo*")},
+			{"predicate", "no?", Intern("no?")},
+			{"plus", "+", Intern("+")},
 		}
 		testReadCases(cases, t)
 	})
 
 	t.Run("characters", func(t *testing.T) {
 		cases := []readCase{
-			{"a", `\a`, 'a'},
-			{"bel", `\bel`, '\a'},
-			{"space", `\space`, ' '},
-			{"tab", `\tab`, '\t'},
+			{"a", `\a`, Char('a')},
+			{"bel", `\bel`, Char('\a')},
+			{"space", `\space`, Char(' ')},
+			{"tab", `\tab`, Char('\t')},
+			{"sp", `\sp`, Char(' ')},
+			{"lf", `\lf`, Char('\n')},
+			{"cr", `\cr`, Char('\r')},
+			{"nul", `\nul`, Char('\000')},
+			{"esc", `\esc`, Char('\033')},
+			{"del", `\del`, Char('\177')},
+			{"unicode escape", `\u00e9`, Char('é')},
+			{"long unicode escape", `\U0001f600`, Char('😀')},
+			{"non-ascii", `\é`, Char('é')},
+			{"double quote", `\"`, Char('"')},
+			{"open paren", `\(`, Char('(')},
 		}
 
 		t.Run("alphanumeric", func(t *testing.T) {
 			for i := 33; i <= 126; i++ {
-				r := rune(i)
+				r := Char(i)
 
-				t.Run(string(r), func(t *testing.T) {
+				t.Run(string(rune(r)), func(t *testing.T) {
 					var s strings.Builder
 					s.WriteRune('\\')
-					s.WriteRune(r)
+					s.WriteRune(rune(r))
 					got := Read(s.String())[0]
 					if !reflect.DeepEqual(r, got) {
 						t.Errorf("Expected %#v when reading '%s' but got %#v", r, s.String(), got)
@@ -55,46 +84,336 @@ func TestRead(t *testing.T) {
 			}
 		})
 		testReadCases(cases, t)
+
+		t.Run("unknown names", func(t *testing.T) {
+			for _, program := range []string{`\nosuchchar`, `\u12`, `\ud800`, `\U00110000`} {
+				if _, err := Parse("", program); err == nil {
+					t.Errorf("Expected an error reading %s", program)
+				}
+			}
+		})
+
+		t.Run("round trip", func(t *testing.T) {
+			for r := rune(0); r <= 0x30000; r++ {
+				if !utf8.ValidRune(r) {
+					continue
+				}
+				s := toString(Char(r))
+				got, err := Parse("", s)
+				if err != nil || len(got) != 1 || got[0] != Char(r) {
+					t.Fatalf("Expected to read %q back as %U but got %#v (%v)", s, r, got, err)
+				}
+			}
+		})
 	})
 
 	t.Run("lists", func(t *testing.T) {
 		cases := []readCase{
 			{"empty list", "()", Nil},
 			{"nil", "nil", Nil},
-			{"one item list", "(1)", &Pair{1, Nil}},
-			{"two item list", "(1 2)", &Pair{1, &Pair{2, Nil}}},
-			{"pair", "(1 . 2)", &Pair{1, 2}},
-			{"three item list", "(1 2 3)", &Pair{1, &Pair{2, &Pair{3, Nil}}}},
-			{"dotted list", "(1 2 . 3)", &Pair{1, &Pair{2, 3}}},
-			{"nested list", "((1))", &Pair{&Pair{1, Nil}, Nil}},
+			{"one item list", "(1)", &Pair{Int(1), Nil}},
+			{"two item list", "(1 2)", &Pair{Int(1), &Pair{Int(2), Nil}}},
+			{"pair", "(1 . 2)", &Pair{Int(1), Int(2)}},
+			{"three item list", "(1 2 3)", &Pair{Int(1), &Pair{Int(2), &Pair{Int(3), Nil}}}},
+			{"dotted list", "(1 2 . 3)", &Pair{Int(1), &Pair{Int(2), Int(3)}}},
+			{"nested list", "((1))", &Pair{&Pair{Int(1), Nil}, Nil}},
 			{"simplest two lists", "( () () )", &Pair{Nil, &Pair{Nil, Nil}}},
 			{"simplest three lists", "( () () () )", &Pair{Nil, &Pair{Nil, &Pair{Nil, Nil}}}},
-			{"list in second place", "( 1 () )", &Pair{1, &Pair{Nil, Nil}}},
-			{"simple two lists", "( (1) (1) )", &Pair{&Pair{1, Nil}, &Pair{&Pair{1, Nil}, Nil}}},
+			{"list in second place", "( 1 () )", &Pair{Int(1), &Pair{Nil, Nil}}},
+			{"simple two lists", "( (1) (1) )", &Pair{&Pair{Int(1), Nil}, &Pair{&Pair{Int(1), Nil}, Nil}}},
 			{"two lists", "(+ (+ 1 2) (+ 3 4))",
-				&Pair{&Symbol{"+"}, &Pair{Read("(+ 1 2)")[0], &Pair{Read("(+ 3 4)")[0], Nil}}}},
+				&Pair{Intern("+"), &Pair{Read("(+ 1 2)")[0], &Pair{Read("(+ 3 4)")[0], Nil}}}},
 		}
 
 		testReadCases(cases, t)
 	})
 
+	t.Run("brackets", func(t *testing.T) {
+		cases := []readCase{
+			{"bracket function", "[f _ x]", Read("(fn (_) (f _ x))")[0]},
+			{"empty brackets", "[]", Read("(fn (_) ())")[0]},
+			{"nested brackets", "[map [f _ 1] _]", Read("(fn (_) (map (fn (_) (f _ 1)) _))")[0]},
+			{"brackets in a list", "(map [car _] xs)", Read("(map (fn (_) (car _)) xs)")[0]},
+		}
+		testReadCases(cases, t)
+	})
+
 	t.Run("strings", func(t *testing.T) {
 		cases := []readCase{
-			{"simple string", `"hello"`, &Pair{'h', &Pair{'e', &Pair{'l', &Pair{'l', &Pair{'o', Nil}}}}}},
-			{"string with space", `"h o"`, &Pair{'h', &Pair{' ', &Pair{'o', Nil}}}},
-			{"string with quote", `"\""`, &Pair{'"', Nil}},
+			{"simple string", `"hello"`, &Pair{Char('h'), &Pair{Char('e'), &Pair{Char('l'), &Pair{Char('l'), &Pair{Char('o'), Nil}}}}}},
+			{"string with space", `"h o"`, &Pair{Char('h'), &Pair{Char(' '), &Pair{Char('o'), Nil}}}},
+			{"string with quote", `"\""`, &Pair{Char('"'), Nil}},
+			{"string with backslash", `"\\"`, &Pair{Char('\\'), Nil}},
+			{"non-ascii string", `"né"`, &Pair{Char('n'), &Pair{Char('é'), Nil}}},
+		}
+		testReadCases(cases, t)
+	})
+
+	t.Run("comments", func(t *testing.T) {
+		cases := []readCase{
+			{"line comment", "(a ; b\n c)", Read("(a c)")[0]},
+			{"line comment before", "; nothing to see\n a", Intern("a")},
+			{"character semicolon", `(\; ; a comment` + "\n)", &Pair{Char(';'), Nil}},
+			{"string semicolon", `";"`, &Pair{Char(';'), Nil}},
+			{"block comment", "(a #| b |# c)", Read("(a c)")[0]},
+			{"nested block comment", "(a #| b #| c |# d |# e)", Read("(a e)")[0]},
+			{"multi-line block comment", "(a #| b\n c\n |# d)", Read("(a d)")[0]},
+			{"datum comment", "(a #;(b c) d)", Read("(a d)")[0]},
+			{"datum comment at the end of a list", "(a #;b)", Read("(a)")[0]},
+			{"datum comment at the start", "#;a b", Intern("b")},
+			{"stacked datum comments", "(a #;#;b c d)", Read("(a d)")[0]},
+			{"datum comment in a dotted tail", "(a . #;b c)", &Pair{Intern("a"), Intern("c")}},
 		}
 		testReadCases(cases, t)
+
+		t.Run("only comments", func(t *testing.T) {
+			got, err := Parse("", "; a\n#| b |# #;c")
+			if err != nil || len(got) != 0 {
+				t.Errorf("Expected nothing but got %v (%v)", got, err)
+			}
+		})
+	})
+
+	t.Run("labels", func(t *testing.T) {
+		t.Run("circular list", func(t *testing.T) {
+			p := Read("#1=(a b . #1#)")[0].(*Pair)
+			if p.Rest.(*Pair).Rest != p {
+				t.Errorf("Expected the tail of %v to be the list itself", p)
+			}
+		})
+
+		t.Run("list containing itself", func(t *testing.T) {
+			p := Read("#1=(a #1#)")[0].(*Pair)
+			if p.Rest.(*Pair).First != p {
+				t.Errorf("Expected the second element of %v to be the list itself", p)
+			}
+		})
+
+		t.Run("shared structure", func(t *testing.T) {
+			p := Read("(#1=(x y) #2=z #1# #2#)")[0].(*Pair)
+			items := []Value{}
+			for ; p != Nil; p = p.Rest.(*Pair) {
+				items = append(items, p.First)
+			}
+			if items[0] != items[2] {
+				t.Errorf("Expected %v and %v to be the same pair", items[0], items[2])
+			}
+			if !reflect.DeepEqual(items[1], items[3]) {
+				t.Errorf("Expected %v and %v to be the same symbol", items[1], items[3])
+			}
+		})
+
+		t.Run("nested labels", func(t *testing.T) {
+			p := Read("#1=(a #2=(b #1#) #2#)")[0].(*Pair)
+			inner := p.Rest.(*Pair).First.(*Pair)
+			if inner.Rest.(*Pair).First != p {
+				t.Errorf("Expected the #1# in %v to be the outer list", p)
+			}
+			if p.Rest.(*Pair).Rest.(*Pair).First != inner {
+				t.Errorf("Expected the #2# in %v to be the inner list", p)
+			}
+		})
+
+		t.Run("a label for another label", func(t *testing.T) {
+			p := Read("#1=(#2=#1#)")[0].(*Pair)
+			if p.First != p {
+				t.Errorf("Expected %v to contain itself", p)
+			}
+		})
+
+		t.Run("print and read back", func(t *testing.T) {
+			for _, program := range []string{
+				"#1=(a #2=(b #1#) #2#)",
+				"(#1=(a . #2=(b #1#)) #2#)",
+				"#1=(#2=(#1# #3=(#2#)) #3#)",
+			} {
+				got := Read(program)[0].String()
+				if got != program {
+					t.Errorf("Expected %s to print as itself but got %s", program, got)
+				}
+			}
+			if got, want := Read("#1=(#2=#1#)")[0].String(), "#1=(#1#)"; got != want {
+				t.Errorf("Expected %s but got %s", want, got)
+			}
+		})
+
+		t.Run("labels belong to one expression", func(t *testing.T) {
+			if _, err := Parse("", "#1=(a) #1#"); err == nil {
+				t.Errorf("Expected an error using a label from another expression")
+			}
+		})
 	})
 
 	t.Run("misc", func(t *testing.T) {
 		cases := []readCase{
-			{"mixed", "(if nil 1 2)", &Pair{&Symbol{"if"}, &Pair{Nil, &Pair{1, &Pair{2, Nil}}}}},
+			{"mixed", "(if nil 1 2)", &Pair{Intern("if"), &Pair{Nil, &Pair{Int(1), &Pair{Int(2), Nil}}}}},
 		}
 		testReadCases(cases, t)
 	})
 }
 
+func TestIntern(t *testing.T) {
+	if Intern("foo") != Intern("foo") {
+		t.Errorf("Expected interning foo twice to give the same symbol")
+	}
+	if Intern("foo") == Intern("bar") {
+		t.Errorf("Expected foo and bar to be different symbols")
+	}
+
+	got := Read("(foo foo) foo")
+	list := got[0].(*Pair)
+	if list.First != list.Rest.(*Pair).First || list.First != got[1] || got[1] != Intern("foo") {
+		t.Errorf("Expected every foo read to be the interned symbol, but got %v", got)
+	}
+	if got := Read("a.b")[0].(*Pair); got.First != Intern("a") {
+		t.Errorf("Expected symbols made from intrasymbol syntax to be interned, but got %v", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		program string
+		line    int
+		column  int
+		token   string
+	}{
+		{"unclosed list", "(1 2", 1, 5, ""},
+		{"unclosed nested list", "(1 (2\n 3)", 2, 4, ""},
+		{"stray close", "1 )", 1, 3, ")"},
+		{"stray dot", ". 1", 1, 1, "."},
+		{"nothing after dot", "(1 . )", 1, 6, ")"},
+		{"too much after dot", "(1 . 2 3)", 1, 8, "3"},
+		{"nothing before dot", "(. 1)", 1, 2, "."},
+		{"quote at end", "'", 1, 2, ""},
+		{"truncated string", `"abc`, 1, 1, `"abc`},
+		{"lone backslash", `\`, 1, 1, `\`},
+		{"close on a later line", "(a)\n\n  )", 3, 3, ")"},
+		{"list closed with a bracket", "(a b]", 1, 5, "]"},
+		{"bracket closed with a paren", "[a b)", 1, 5, ")"},
+		{"unclosed bracket", "[a", 1, 3, ""},
+		{"stray bracket", "a ]", 1, 3, "]"},
+		{"brace without a read macro", "(a {b})", 1, 4, "{"},
+		{"divide by zero", "1/0", 1, 1, "1/0"},
+		{"undefined label", "(a #1#)", 1, 4, "#1#"},
+		{"label defined twice", "(#1=a #1=b)", 1, 7, "#1="},
+		{"label of nothing but itself", "#1=#1#", 1, 7, ""},
+		{"bad label", "#1 a", 1, 1, "#1"},
+		{"unterminated block comment", "a #| b", 1, 3, "#|"},
+		{"datum comment with nothing after it", "a #;", 1, 5, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Parse("test.bel", c.program)
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("Expected a *ParseError reading %q but got %#v", c.program, err)
+			}
+			if perr.Pos.Filename != "test.bel" || perr.Pos.Line != c.line || perr.Pos.Column != c.column {
+				t.Errorf("Expected error at test.bel:%d:%d but got %s", c.line, c.column, perr.Pos)
+			}
+			if perr.Token != c.token {
+				t.Errorf("Expected offending token %q but got %q", c.token, perr.Token)
+			}
+		})
+	}
+
+	t.Run("good input", func(t *testing.T) {
+		got, err := Parse("test.bel", "(1 2) 3")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(got) != 2 {
+			t.Errorf("Expected two expressions but got %v", got)
+		}
+	})
+}
+
+func TestReader(t *testing.T) {
+	t.Run("reads one expression at a time", func(t *testing.T) {
+		r := NewReader(strings.NewReader("(1\n 2) 3"))
+		want := []Value{&Pair{Int(1), &Pair{Int(2), Nil}}, Int(3)}
+		for _, w := range want {
+			got, err := r.ReadExpr()
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !reflect.DeepEqual(w, got) {
+				t.Errorf("Expected %v but got %v", w, got)
+			}
+		}
+		if _, err := r.ReadExpr(); err != io.EOF {
+			t.Errorf("Expected io.EOF but got %v", err)
+		}
+	})
+
+	t.Run("does not wait for input after a closed expression", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		go func() {
+			pw.Write([]byte("(1\n"))
+			pw.Write([]byte("2)\n"))
+		}()
+
+		r := NewReader(pr)
+		got, err := r.ReadExpr()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if want := (&Pair{Int(1), &Pair{Int(2), Nil}}); !reflect.DeepEqual(want, got) {
+			t.Errorf("Expected %v but got %v", want, got)
+		}
+
+		go func() {
+			pw.Write([]byte("3"))
+			pw.Close()
+		}()
+		if got, _ := r.ReadExpr(); got != Int(3) {
+			t.Errorf("Expected 3 but got %v", got)
+		}
+		if _, err := r.ReadExpr(); err != io.EOF {
+			t.Errorf("Expected io.EOF but got %v", err)
+		}
+	})
+
+	t.Run("input ending inside an expression", func(t *testing.T) {
+		r := NewReader(strings.NewReader("(1 2"))
+		r.Filename = "test.bel"
+		_, err := r.ReadExpr()
+		if _, ok := err.(*ParseError); !ok {
+			t.Errorf("Expected a *ParseError but got %#v", err)
+		}
+	})
+
+	t.Run("carries on after a syntax error", func(t *testing.T) {
+		for _, program := range []string{")  a", ". a", "] a", "(a . ) b", "#1# b"} {
+			r := NewReader(strings.NewReader(program))
+			if _, err := r.ReadExpr(); err == nil {
+				t.Fatalf("Expected an error reading %q", program)
+			}
+			got, err := r.ReadExpr()
+			if err != nil {
+				t.Fatalf("Expected to read on after the error in %q but got %v", program, err)
+			}
+			if _, ok := got.(*Symbol); !ok {
+				t.Errorf("Expected to read a symbol after the error in %q but got %v", program, got)
+			}
+			if _, err := r.ReadExpr(); err != io.EOF {
+				t.Errorf("Expected io.EOF after %q but got %v", program, err)
+			}
+		}
+	})
+}
+
+func bigInt(s string) *BigInt {
+	n, _ := new(big.Int).SetString(s, 10)
+	return (*BigInt)(n)
+}
+
+func rat(a, b int64) *Rat {
+	return (*Rat)(big.NewRat(a, b))
+}
+
 func testReadCases(cases []readCase, t *testing.T) {
 	for i := range cases {
 		c := cases[i]
@@ -112,5 +431,5 @@ func testReadCases(cases []readCase, t *testing.T) {
 type readCase struct {
 	name    string
 	program string
-	want    interface{}
+	want    Value
 }
@@ -0,0 +1,118 @@
+package gobel
+
+import (
+	"errors"
+	"strings"
+)
+
+// Bel lets some characters inside a symbol stand for a call. From the loosest
+// binding to the tightest:
+//
+//	x|f     (t x f)
+//	a.b!c   (a b 'c), with a leading . or ! meaning (upon ...)
+//	f:g     (compose f g)
+//	~f      (compose no f)
+const intrasymbolChars = "|.!:~"
+
+// parseSymbol reads a token that isn't a number or a character, expanding any
+// intrasymbol syntax in it.
+func parseSymbol(s string) (Value, error) {
+	if !strings.ContainsAny(s, intrasymbolChars) {
+		return word(s), nil
+	}
+	if strings.Contains(s, "|") {
+		return parseTspec(s)
+	}
+	if strings.ContainsAny(s, ".!") {
+		return parseSlist(s)
+	}
+	return parseCompose(s), nil
+}
+
+// parseTspec reads x|f, which is (t x f).
+func parseTspec(s string) (Value, error) {
+	parts := strings.Split(s, "|")
+	if len(parts) > 2 {
+		return nil, errors.New("more than one | in a symbol")
+	}
+	if parts[0] == "" || parts[1] == "" {
+		return nil, errors.New("| needs something on either side of it")
+	}
+	x, err := parseSymbol(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseSymbol(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return listOf(Intern("t"), x, f), nil
+}
+
+// parseSlist reads a.b!c, which is (a b 'c). A symbol that starts with . or !
+// calls upon on the rest, so .a is (upon a).
+func parseSlist(s string) (Value, error) {
+	var items []Value
+	if strings.IndexAny(s, ".!") == 0 {
+		items = append(items, Intern("upon"))
+	} else {
+		s = "." + s
+	}
+	for s != "" {
+		op := s[0]
+		s = s[1:]
+		end := strings.IndexAny(s, ".!")
+		if end == -1 {
+			end = len(s)
+		}
+		if end == 0 {
+			if s == "" {
+				return nil, errors.New("symbol ends with " + string(op))
+			}
+			return nil, errors.New("two . or ! in a row in a symbol")
+		}
+		item := parseCompose(s[:end])
+		if op == '!' {
+			item = listOf(Intern("quote"), item)
+		}
+		items = append(items, item)
+		s = s[end:]
+	}
+	return listOf(items...), nil
+}
+
+// parseCompose reads f:g, which is (compose f g).
+func parseCompose(s string) Value {
+	if !strings.Contains(s, ":") {
+		return parseNo(s)
+	}
+	items := []Value{Intern("compose")}
+	for _, part := range strings.Split(s, ":") {
+		if part != "" {
+			items = append(items, parseNo(part))
+		}
+	}
+	return listOf(items...)
+}
+
+// parseNo reads ~f, which is (compose no f). On its own ~ is no.
+func parseNo(s string) Value {
+	if !strings.HasPrefix(s, "~") {
+		return word(s)
+	}
+	if s == "~" {
+		return Intern("no")
+	}
+	return listOf(Intern("compose"), Intern("no"), parseNo(s[1:]))
+}
+
+// word reads a token with no intrasymbol syntax left in it.
+func word(s string) Value {
+	if s == "nil" {
+		return Nil
+	}
+	if n, ok, err := parseNumber(s); ok && err == nil {
+		return n
+	}
+	return Intern(s)
+}
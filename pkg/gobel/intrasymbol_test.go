@@ -0,0 +1,76 @@
+package gobel
+
+import (
+	"testing"
+)
+
+func TestIntrasymbol(t *testing.T) {
+	t.Run("t", func(t *testing.T) {
+		cases := []readCase{
+			{"type spec", "x|int", Read("(t x int)")[0]},
+			{"type spec in a parameter list", "(fn (x|int) x)", Read("(fn ((t x int)) x)")[0]},
+			{"type spec binds loosest", "x|~f:g", Read("(t x (compose (compose no f) g))")[0]},
+			{"type spec around a call", "x|a.b", Read("(t x (a b))")[0]},
+		}
+		testReadCases(cases, t)
+	})
+
+	t.Run(".", func(t *testing.T) {
+		cases := []readCase{
+			{"call", "a.b", Read("(a b)")[0]},
+			{"longer call", "a.b.c", Read("(a b c)")[0]},
+			{"number argument", "a.1", Read("(a 1)")[0]},
+			{"leading dot", ".a", Read("(upon a)")[0]},
+			{"dot binds looser than compose", "f:g.x", Read("((compose f g) x)")[0]},
+		}
+		testReadCases(cases, t)
+	})
+
+	t.Run("!", func(t *testing.T) {
+		cases := []readCase{
+			{"quoted call", "a!b", Read("(a 'b)")[0]},
+			{"mixed with dot", "a!b.c", Read("(a 'b c)")[0]},
+			{"leading bang", "!a", Read("(upon 'a)")[0]},
+		}
+		testReadCases(cases, t)
+	})
+
+	t.Run(":", func(t *testing.T) {
+		cases := []readCase{
+			{"compose", "f:g", Read("(compose f g)")[0]},
+			{"longer compose", "f:g:h", Read("(compose f g h)")[0]},
+			{"compose binds looser than no", "~f:g", Read("(compose (compose no f) g)")[0]},
+			{"compose in a call", "(f:g x)", Read("((compose f g) x)")[0]},
+		}
+		testReadCases(cases, t)
+	})
+
+	t.Run("~", func(t *testing.T) {
+		cases := []readCase{
+			{"no", "~f", Read("(compose no f)")[0]},
+			{"no no", "~~f", Read("(compose no (compose no f))")[0]},
+			{"on its own", "~", Intern("no")},
+		}
+		testReadCases(cases, t)
+	})
+
+	t.Run("plain symbols", func(t *testing.T) {
+		cases := []readCase{
+			{"symbol", "abc", Intern("abc")},
+			{"dotted pair still reads", "(a . b)", &Pair{Intern("a"), Intern("b")}},
+		}
+		testReadCases(cases, t)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []string{"a.", "a!", "a..b", "a.!b", "a|b|c", "|a", "a|"}
+		for _, c := range cases {
+			t.Run(c, func(t *testing.T) {
+				_, err := Parse("", c)
+				if _, ok := err.(*ParseError); !ok {
+					t.Errorf("Expected a *ParseError reading %q but got %#v", c, err)
+				}
+			})
+		}
+	})
+}
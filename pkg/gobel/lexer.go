@@ -1,50 +1,169 @@
 package gobel
 
 import (
+	"errors"
 	"io"
+	"strings"
 	"text/scanner"
 	"unicode"
 )
 
 // ScanLexer lexes a Bel program into tokens, represented as strings. Internally
 // it wraps the Go `text/scanner.Scanner` and hacks around with it to make it fit.
+// It tokenizes much as Go would, so symbols like <= or no? come out in pieces;
+// NewReader uses a BelLexer, and ScanLexer stays around to check it against.
+//
+// Tokens are scanned lazily: Next only notes that the current token has been
+// used up, and the following one isn't read until it's asked for. This stops
+// an interactive reader blocking on the line after a complete expression.
 type ScanLexer struct {
 	scanner scanner.Scanner
 	tok     rune
 	current string
+	pos     scanner.Position
+	err     error
+	pending bool
 }
 
 func NewScanLexer(r io.Reader) *ScanLexer {
-	var s scanner.Scanner
-	s.Init(r)
-	s.Mode = scanner.ScanIdents | scanner.ScanStrings | scanner.ScanInts
-	s.IsIdentRune = func(ch rune, i int) bool {
+	l := &ScanLexer{}
+	l.scanner.Init(r)
+	l.scanner.Mode = scanner.ScanIdents | scanner.ScanStrings | scanner.ScanInts
+	l.scanner.IsIdentRune = func(ch rune, i int) bool {
 		return ch == '_' ||
 			ch == '-' ||
+			strings.ContainsRune(intrasymbolChars, ch) ||
 			unicode.IsLetter(ch) ||
 			unicode.IsDigit(ch) && i > 0
 	}
-
-	l := &ScanLexer{
-		scanner: s,
+	l.scanner.Error = func(s *scanner.Scanner, msg string) {
+		if l.err == nil {
+			l.err = errors.New(msg)
+		}
 	}
-	l.Next()
+
+	l.pending = true
 	return l
 }
 
 func (l *ScanLexer) Current() string {
+	l.fill()
 	return l.current
 }
 
 func (l *ScanLexer) Next() {
-	l.tok = l.scanner.Scan()
-	l.current = l.scanner.TokenText()
+	l.fill()
+	l.pending = true
+}
+
+func (l *ScanLexer) fill() {
+	if !l.pending {
+		return
+	}
+	l.pending = false
+	l.err = nil
+	for {
+		l.tok = l.scanner.Scan()
+		l.pos = l.scanner.Position
+		l.current = l.scanner.TokenText()
+		if l.tok == ';' {
+			l.skipLine()
+			continue
+		}
+		if l.tok == '#' && l.scanner.Peek() == '|' {
+			if l.skipBlock() {
+				continue
+			}
+			l.current = "#|"
+		}
+		break
+	}
 	if l.tok == '\\' { // small hack to handle Bel characters
+		l.current += l.charName()
+	}
+	if l.tok == ',' && l.scanner.Peek() == '@' {
+		l.current += string(l.scanner.Next())
+	}
+	if l.scanner.Peek() == '/' && isInteger(l.current) { // a ratio like 3/4
+		l.current += string(l.scanner.Next())
+		for isDigits(string(l.scanner.Peek())) {
+			l.current += string(l.scanner.Next())
+		}
+	}
+	if l.tok == '#' && isDigits(string(l.scanner.Peek())) { // a label like #1= or #1#
+		for isDigits(string(l.scanner.Peek())) {
+			l.current += string(l.scanner.Next())
+		}
+		if next := l.scanner.Peek(); next == '=' || next == '#' {
+			l.current += string(l.scanner.Next())
+		}
+	}
+	if l.tok == '#' && l.scanner.Peek() == ';' {
+		l.current += string(l.scanner.Next())
+	}
+}
+
+// skipLine skips the rest of a ; comment.
+func (l *ScanLexer) skipLine() {
+	for ch := l.scanner.Peek(); ch != '\n' && ch != scanner.EOF; ch = l.scanner.Peek() {
+		l.scanner.Next()
+	}
+}
+
+// skipBlock skips a #| ... |# comment, which can have other block comments
+// nested inside it. It reports whether it found the end of the comment.
+func (l *ScanLexer) skipBlock() bool {
+	l.scanner.Next()
+	depth := 1
+	for prev := rune(0); depth > 0; {
+		ch := l.scanner.Next()
+		switch {
+		case ch == scanner.EOF:
+			if l.err == nil {
+				l.err = errors.New("comment not terminated")
+			}
+			return false
+		case prev == '#' && ch == '|':
+			depth++
+			ch = 0
+		case prev == '|' && ch == '#':
+			depth--
+			ch = 0
+		}
+		prev = ch
+	}
+	return true
+}
+
+// charName reads whatever follows a backslash. Names are scanned as a single
+// token, anything else is taken a rune at a time so that `\"` and `\(` don't
+// send the scanner off looking for the end of a string or list.
+func (l *ScanLexer) charName() string {
+	next := l.scanner.Peek()
+	if next == scanner.EOF {
+		return ""
+	}
+	if unicode.IsLetter(next) || unicode.IsDigit(next) {
 		l.scanner.Scan()
-		l.current += l.scanner.TokenText()
+		return l.scanner.TokenText()
 	}
+	return string(l.scanner.Next())
 }
 
 func (l *ScanLexer) End() bool {
+	l.fill()
 	return l.tok == scanner.EOF
 }
+
+// Pos returns the position of the start of the current token.
+func (l *ScanLexer) Pos() scanner.Position {
+	l.fill()
+	return l.pos
+}
+
+// Err returns the first error the underlying scanner reported while reading the
+// current token, if any.
+func (l *ScanLexer) Err() error {
+	l.fill()
+	return l.err
+}
@@ -21,6 +21,16 @@ func TestScanLexer(t *testing.T) {
 		{"snake_case", "snake_case", []string{"snake_case"}},
 		{"kebab-case-OK", "kebab-case", []string{"kebab-case"}},
 		{"quote tick", "'one 'two", []string{"'", "one", "'", "two"}},
+		{"intrasymbol", "(a.b x|int ~f:g c!d)", []string{"(", "a.b", "x|int", "~f:g", "c!d", ")"}},
+		{"line comment", "a ; comment (\nb", []string{"a", "b"}},
+		{"comment at the end", "a ;", []string{"a"}},
+		{"block comment", "a #| (b |# c", []string{"a", "c"}},
+		{"nested block comment", "a #| b #| c |# d |# e", []string{"a", "e"}},
+		{"datum comment", "#;(a) b", []string{"#;", "(", "a", ")", "b"}},
+		{"ratios", "(3/4 -1/2)", []string{"(", "3/4", "-1/2", ")"}},
+		{"labels", "#1=(a . #1#)", []string{"#1=", "(", "a", ".", "#1#", ")"}},
+		{"brackets", "[f _]", []string{"[", "f", "_", "]"}},
+		{"backquote", "`(,a ,@b)", []string{"`", "(", ",", "a", ",@", "b", ")"}},
 	}
 
 	for _, c := range cases {
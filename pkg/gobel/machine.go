@@ -0,0 +1,555 @@
+package gobel
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// machine evaluates Bel with a stack of frames of its own rather than on Go's
+// stack. Each frame is a step of the computation that's waiting for a value,
+// so the stack is the rest of the computation: ccc captures it just by keeping
+// hold of it. Frames are never changed once they're made, so a continuation
+// can be resumed any number of times, even after the computation has carried
+// on past it.
+//
+// Go code that calls back into Bel, such as a function given to Define, runs a
+// machine of its own inside the one that called Go, and so do the defaults of
+// optional parameters and the parts of a place being set. The inner machine
+// starts with the dynamic bindings of the outer one, so errors it signals
+// reach the handlers outside, but a continuation captured in it only reaches
+// as far as where it was started. One called from inside it can still get out
+// to the machine it belongs to.
+//
+// Anything evaluated in tail position, which is the last expression in the
+// body of a function, the branch an if takes, and the expansion of a macro, is
+// evaluated in place of the expression that led to it rather than on top of
+// it, so loops written as recursion run in a constant amount of stack.
+type machine struct {
+	stack *stack
+	// calls are the function and macro calls being evaluated in the
+	// expression the machine is working on, for errors to report
+	calls *callList
+	// dyn is the dynamic bindings in force, which are part of the rest of
+	// the computation just as the stack is
+	dyn *dynBinding
+
+	// The machine either evaluates expr in env, or returns value to the
+	// frame on top of the stack.
+	expr      Value
+	env       *Env
+	value     Value
+	returning bool
+
+	// done is set once run has returned. Continuations made by a machine
+	// that's done are carried on by whichever machine calls them.
+	done bool
+}
+
+// frame is a step of a computation that's waiting for a value.
+type frame interface {
+	resume(m *machine, v Value) error
+}
+
+// stack is a stack of frames. Each keeps the calls that were being evaluated
+// and the dynamic bindings in force when it was pushed, which become the
+// machine's again when it resumes.
+type stack struct {
+	frame frame
+	calls *callList
+	dyn   *dynBinding
+	next  *stack
+}
+
+// dynBinding is a binding made by dyn, or by catch or on-err, which is seen by
+// everything evaluated inside them, whatever function it's in, ahead of any
+// lexical binding of the same name.
+type dynBinding struct {
+	name  *Symbol
+	value Value
+	next  *dynBinding
+}
+
+// without is the bindings with b left out.
+func (l *dynBinding) without(b *dynBinding) *dynBinding {
+	if l == nil {
+		return nil
+	}
+	if l == b {
+		return b.next
+	}
+	next := l.next.without(b)
+	if next == l.next {
+		return l
+	}
+	return &dynBinding{l.name, l.value, next}
+}
+
+// find is the innermost binding of name, or nil if there isn't one.
+func (b *dynBinding) find(name *Symbol) *dynBinding {
+	for ; b != nil; b = b.next {
+		if b.name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// maxTails is how many of the calls that have been replaced by tail calls an
+// error reports. A loop can make any number of them.
+const maxTails = 32
+
+// callList is the calls being evaluated in one expression, most recent first:
+// the one it's evaluating, and those it replaced by tail calls. Lists are
+// shared by frames and continuations, so they're never changed, and a long
+// one is cut back to the most recent calls now and then so that a loop
+// doesn't make it grow without end.
+type callList struct {
+	call *Pair
+	prev *callList
+	n    int
+}
+
+func (l *callList) push(call *Pair) *callList {
+	if l == nil {
+		return &callList{call, nil, 1}
+	}
+	if l.n > 8*maxTails {
+		l = l.latest(maxTails + 1)
+	}
+	return &callList{call, l, l.n + 1}
+}
+
+// latest is a new list of the n most recent calls in l.
+func (l *callList) latest(n int) *callList {
+	calls := make([]*Pair, 0, n)
+	for ; l != nil && len(calls) < n; l = l.prev {
+		calls = append(calls, l.call)
+	}
+	var r *callList
+	for i := len(calls) - 1; i >= 0; i-- {
+		r = &callList{calls[i], r, len(calls) - i}
+	}
+	return r
+}
+
+// addTo adds the calls to the stack of e.
+func (l *callList) addTo(e *BelError) {
+	for i := 0; l != nil && i <= maxTails; i, l = i+1, l.prev {
+		e.Stack = append(e.Stack, l.call)
+	}
+}
+
+// Continuation is the rest of a computation, as ccc captures it. Calling it
+// with a value carries on from where ccc was called, as if ccc had returned
+// the value, and abandons whatever was being done when it was called.
+type Continuation struct {
+	m     *machine
+	stack *stack
+	calls *callList
+	dyn   *dynBinding
+}
+
+func (*Continuation) isValue()         {}
+func (*Continuation) Type() *Symbol    { return Intern("cont") }
+func (k *Continuation) String() string { return fmt.Sprintf("#[continuation %v]", unsafe.Pointer(k)) }
+
+// jump is how a continuation is called from inside a call from Go back into
+// Bel, such as a function passed to maptable, when the machine the
+// continuation belongs to is the one that called Go. The machine running the
+// inner call can't carry on with it, so it returns the jump as its error,
+// which Go code passes back until it reaches the machine that can.
+type jump struct {
+	k     *Continuation
+	value Value
+}
+
+func (j *jump) Error() string {
+	return "a continuation was called from outside the evaluation it belongs to"
+}
+
+// eval evaluates expression in env, on a machine inside outer, which is nil
+// if there's no Bel running.
+func eval(outer *machine, expression Value, env *Env) (Value, error) {
+	m := outer.inner()
+	m.evalTail(expression, env)
+	return m.run(nil)
+}
+
+// apply calls the function fn with args, on a machine inside outer, which is
+// nil if there's no Bel running.
+func apply(outer *machine, fn Value, args *Pair) (Value, error) {
+	m := outer.inner()
+	return m.run(m.apply(fn, args))
+}
+
+// inner makes a machine to run inside m, which sees its dynamic bindings.
+func (m *machine) inner() *machine {
+	if m == nil {
+		return &machine{}
+	}
+	return &machine{dyn: m.dyn}
+}
+
+// run runs the machine until the computation is finished, starting from the
+// error that getting it going may have failed with. Errors are signalled to
+// the handler bound to err, if there is one.
+func (m *machine) run(err error) (Value, error) {
+	defer func() { m.done = true }()
+	for {
+		switch e := err.(type) {
+		case nil:
+		case *jump:
+			if e.k.m != m {
+				return nil, e
+			}
+			m.install(e.k, e.value)
+		default:
+			h := m.dyn.find(Intern("err"))
+			if h == nil {
+				return nil, m.fail(err)
+			}
+			err = m.signal(belError(err), h)
+			continue
+		}
+		if !m.returning {
+			err = m.step()
+			continue
+		}
+		top := m.stack
+		if top == nil {
+			return m.value, nil
+		}
+		m.stack, m.calls, m.dyn = top.next, top.calls, top.dyn
+		err = top.frame.resume(m, m.value)
+	}
+}
+
+// signal calls the handler h binds err to with e, in the context the error
+// happened in. The handler runs without h, so that errors in it go to the
+// handler outside, and if it returns, rather than leaving the way on-err's
+// handlers do, e goes on to that handler too.
+func (m *machine) signal(e *BelError, h *dynBinding) error {
+	m.dyn = m.dyn.without(h)
+	m.push(&raiseFrame{e})
+	return m.apply(h.value, listOf(e))
+}
+
+// raiseFrame waits for a handler that may return, to signal err again.
+type raiseFrame struct {
+	err *BelError
+}
+
+func (f *raiseFrame) resume(*machine, Value) error {
+	return f.err
+}
+
+// fail adds the calls being evaluated to the stack of err, which happened
+// while they were, most recent first.
+func (m *machine) fail(err error) *BelError {
+	e := belError(err)
+	m.calls.addTo(e)
+	for s := m.stack; s != nil; s = s.next {
+		s.calls.addTo(e)
+	}
+	return e
+}
+
+// ret returns v to the frame on top of the stack.
+func (m *machine) ret(v Value) {
+	m.value, m.returning = v, true
+}
+
+// evalTail evaluates expr in place of the expression being evaluated.
+func (m *machine) evalTail(expr Value, env *Env) {
+	m.expr, m.env, m.returning = expr, env, false
+}
+
+// push pushes f onto the stack, and starts on a new expression.
+func (m *machine) push(f frame) {
+	m.stack = &stack{f, m.calls, m.dyn, m.stack}
+	m.calls = nil
+}
+
+// bind binds name to value dynamically while the expression the machine goes
+// on to evaluate is evaluated, and returns the binding.
+func (m *machine) bind(name *Symbol, value Value) *dynBinding {
+	m.push(unbindFrame{})
+	m.dyn = &dynBinding{name, value, m.dyn}
+	return m.dyn
+}
+
+// unbindFrame ends a dynamic binding. It's pushed before the binding is made,
+// so the bindings are what they were before once it resumes, and it passes on
+// the value of what was evaluated inside the binding.
+type unbindFrame struct{}
+
+func (unbindFrame) resume(m *machine, v Value) error {
+	m.ret(v)
+	return nil
+}
+
+// evalThen evaluates expr and gives its value to f. Atoms are evaluated
+// straight away, which saves pushing a frame for most arguments.
+func (m *machine) evalThen(expr Value, env *Env, f frame) error {
+	if isAtom(expr) {
+		v, err := m.evalAtom(expr, env)
+		if err != nil {
+			return err
+		}
+		return f.resume(m, v)
+	}
+	m.push(f)
+	m.evalTail(expr, env)
+	return nil
+}
+
+// isAtom reports whether expr evaluates without calling anything, which is
+// anything but a non-empty list. Strings are lists of characters, and evaluate
+// to themselves.
+func isAtom(expr Value) bool {
+	p, ok := expr.(*Pair)
+	if !ok {
+		return true
+	}
+	for ; ok && p != Nil; p, ok = p.Rest.(*Pair) {
+		if _, ok := p.First.(Char); !ok {
+			return false
+		}
+	}
+	return ok
+}
+
+// evalAtom evaluates an atom. A symbol's dynamic binding comes before its
+// binding in env.
+func (m *machine) evalAtom(expression Value, env *Env) (Value, error) {
+	switch v := expression.(type) {
+	case nil:
+		return Nil, nil
+	case *Symbol:
+		if b := m.dyn.find(v); b != nil {
+			return b.value, nil
+		}
+		return env.get(v.name)
+	}
+	return expression, nil
+}
+
+// step evaluates the expression the machine is working on.
+func (m *machine) step() error {
+	if isAtom(m.expr) {
+		value, err := m.evalAtom(m.expr, m.env)
+		if err != nil {
+			return err
+		}
+		m.ret(value)
+		return nil
+	}
+	v := m.expr.(*Pair)
+	args, ok := properList(v.Rest)
+	if !ok {
+		return belErrorf(TypeError, "cannot evaluate the dotted list %s", v)
+	}
+	if !isAtom(v.First) {
+		m.push(&operatorFrame{v, args, m.env})
+		m.evalTail(v.First, m.env)
+		return nil
+	}
+	op, err := m.evalAtom(v.First, m.env)
+	if err != nil {
+		return err
+	}
+	return m.operate(v, args, op, m.env)
+}
+
+// operatorFrame waits for the operator of call.
+type operatorFrame struct {
+	call *Pair
+	args *Pair
+	env  *Env
+}
+
+func (f *operatorFrame) resume(m *machine, op Value) error {
+	return m.operate(f.call, f.args, op, f.env)
+}
+
+// operate evaluates call, whose operator is op and whose arguments are args.
+func (m *machine) operate(call, args *Pair, op Value, env *Env) error {
+	if s, ok := op.(*SpecialForm); ok {
+		if s.step != nil {
+			return s.step(m, args, env)
+		}
+		v, err := s.form(args, env)
+		if err != nil {
+			return err
+		}
+		m.ret(v)
+		return nil
+	}
+	m.calls = m.calls.push(call)
+	if mac, ok := op.(*Macro); ok {
+		m.push(&expansionFrame{env})
+		return m.apply(mac.procedure, args)
+	}
+	return m.evalArgs(op, args, Nil, env)
+}
+
+// expansionFrame waits for the expansion of a macro call, which it evaluates
+// in its place.
+type expansionFrame struct {
+	env *Env
+}
+
+func (f *expansionFrame) resume(m *machine, expansion Value) error {
+	m.evalTail(expansion, f.env)
+	return nil
+}
+
+// evalArgs evaluates the arguments args to fn in turn, and then calls it.
+// done holds the values of the arguments before them, last first.
+func (m *machine) evalArgs(fn Value, args, done *Pair, env *Env) error {
+	for ; !allAtoms(args); args = cdrPair(args) {
+		if !isAtom(args.First) {
+			m.push(&argFrame{fn, cdrPair(args), done, env})
+			m.evalTail(args.First, env)
+			return nil
+		}
+		v, err := m.evalAtom(args.First, env)
+		if err != nil {
+			return err
+		}
+		done = cons(v, done)
+	}
+	// the rest of the arguments are atoms, which is most often all of them,
+	// so their values can go straight on the end of the list
+	values := Nil
+	var last *Pair
+	for ; args != Nil; args = cdrPair(args) {
+		v, err := m.evalAtom(args.First, env)
+		if err != nil {
+			return err
+		}
+		p := cons(v, Nil)
+		if last == nil {
+			values = p
+		} else {
+			last.Rest = p
+		}
+		last = p
+	}
+	for ; done != Nil; done = cdrPair(done) {
+		values = cons(done.First, values)
+	}
+	return m.apply(fn, values)
+}
+
+func allAtoms(l *Pair) bool {
+	for p := l; p != Nil; p = cdrPair(p) {
+		if !isAtom(p.First) {
+			return false
+		}
+	}
+	return true
+}
+
+// argFrame waits for the value of an argument to fn.
+type argFrame struct {
+	fn   Value
+	rest *Pair
+	done *Pair
+	env  *Env
+}
+
+func (f *argFrame) resume(m *machine, v Value) error {
+	return m.evalArgs(f.fn, f.rest, cons(v, f.done), f.env)
+}
+
+// apply calls fn with args.
+func (m *machine) apply(fn Value, args *Pair) error {
+	for fn == Intern("apply") {
+		var err error
+		if fn, args, err = spread(args); err != nil {
+			return err
+		}
+	}
+	switch f := fn.(type) {
+	case *Procedure:
+		env, err := extendEnv(m, f.parameters, args, f.env)
+		if err != nil {
+			return err
+		}
+		m.evalBody(f.body, env)
+		return nil
+	case *NativeProcedure:
+		if f.step != nil {
+			return f.step(m, args)
+		}
+		v, err := f.application(args)
+		if err != nil {
+			return err
+		}
+		m.ret(v)
+		return nil
+	case *Table:
+		v, err := applyTable(f, args)
+		if err != nil {
+			return err
+		}
+		m.ret(v)
+		return nil
+	case *Continuation:
+		return m.resume(f, car(args))
+	}
+	return belErrorf(NotCallableError, "%s is not a function", toString(fn))
+}
+
+// evalBody evaluates each of the expressions in body, the last in place of the
+// call to the function it's the body of.
+func (m *machine) evalBody(body *Pair, env *Env) {
+	if isNil(cdr(body)) {
+		m.evalTail(car(body), env)
+		return
+	}
+	m.push(&bodyFrame{cdrPair(body), env})
+	m.evalTail(body.First, env)
+}
+
+// bodyFrame waits for an expression in the body of a function, before going on
+// to the rest.
+type bodyFrame struct {
+	rest *Pair
+	env  *Env
+}
+
+func (f *bodyFrame) resume(m *machine, _ Value) error {
+	m.evalBody(f.rest, f.env)
+	return nil
+}
+
+// continuation is the rest of the computation from here.
+func (m *machine) continuation() *Continuation {
+	return &Continuation{m, m.stack, m.calls, m.dyn}
+}
+
+// resume carries on with the continuation k, as if the ccc that made it had
+// returned v.
+func (m *machine) resume(k *Continuation, v Value) error {
+	if k.m != m && !k.m.done {
+		return &jump{k, v}
+	}
+	m.install(k, v)
+	return nil
+}
+
+func (m *machine) install(k *Continuation, v Value) {
+	m.stack, m.calls, m.dyn = k.stack, k.calls, k.dyn
+	m.ret(v)
+}
+
+// callCC is Bel's ccc, which calls its argument with the continuation of the
+// call to ccc.
+func callCC(m *machine, args *Pair) error {
+	if !isNil(cdr(args)) {
+		return belErrorf(ArityError, "overargs: too many arguments to ccc")
+	}
+	return m.apply(car(args), listOf(m.continuation()))
+}
@@ -0,0 +1,137 @@
+package gobel
+
+import (
+	"testing"
+)
+
+func TestContinuations(t *testing.T) {
+	env := GlobalEnv()
+	env.Define("each", func(f func(int), ns []int) {
+		for _, n := range ns {
+			f(n)
+		}
+	})
+	_, err := Eval(Read(`
+; a generator hands back the elements of xs one call at a time, picking up
+; where it left off
+(def make-gen (xs)
+  (let return nil
+    (let resume nil
+      (fn ()
+        (ccc (fn (r)
+               (set return r)
+               (if resume
+                 (resume nil)
+                 (do (map (fn (x)
+                            (ccc (fn (k)
+                                   (set resume k)
+                                   (return x))))
+                          xs)
+                     (return 'done)))))))))
+
+; choose picks each of xs in turn, going back to the latest choice whenever
+; fail is called
+(set fails nil)
+
+(def fail ()
+  (let k (car fails)
+    (set fails (cdr fails))
+    (k nil)))
+
+(def choose (xs)
+  (ccc (fn (k)
+         (map (fn (x)
+                (ccc (fn (next)
+                       (set fails (join next fails))
+                       (k x))))
+              xs)
+         (fail))))
+
+; coroutines take turns, each giving way to the next in the queue when it
+; yields
+(set queue nil)
+
+(def yield ()
+  (ccc (fn (k)
+         (set queue (snoc queue k))
+         (next-in-queue))))
+
+(def next-in-queue ()
+  (let k (car queue)
+    (set queue (cdr queue))
+    (k nil)))
+
+(def spawn (f)
+  (set queue (snoc queue (fn (_) (f) (finish)))))
+
+(def run-all ()
+  (ccc (fn (done)
+         (set finish (fn () (if queue (next-in-queue) (done 'finished))))
+         (finish))))
+
+(def worker (name n)
+  (if (id n 0)
+    nil
+    (do (set out (snoc out (list name n)))
+        (yield)
+        (worker name (- n 1)))))
+`), env)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	cases := []evalCase{
+		{"returning normally", Read("(ccc (fn (k) 'a))"), env, Intern("a")},
+		{"early exit", Read("(ccc (fn (k) (car (k 'out))))"), env, Intern("out")},
+		{"exit from a loop", Read("(ccc (fn (k) (map (fn (x) (if (id x 2) (k x))) '(1 2 3)) 'none))"), env, Int(2)},
+		{"the rest of the computation", Read("(list 'a (ccc (fn (k) (k 'b))) 'c)"), env, Read("(a b c)")[0]},
+		{"resumed more than once", Read(`
+(let results nil
+  (let x (ccc (fn (k) (set again k) 1))
+    (set results (join x results))
+    (if (id x 3) results (again (+ x 1)))))`), env, Read("(3 2 1)")[0]},
+		{"through apply", Read("(apply ccc (list (fn (k) (k 'a) 'b)))"), env, Intern("a")},
+		{"out of a Go callback", Read("(ccc (fn (k) (each (fn (n) (if (id n 2) (k 'found))) '(1 2 3)) 'missing))"), env, Intern("found")},
+		{"out of maptable", Read("(ccc (fn (k) (maptable (fn (key v) (if (id v 2) (k key))) (table '((a . 1) (b . 2)))) nil))"), env, Intern("b")},
+		{"the type", Read("(ccc (fn (k) (type k)))"), env, Intern("cont")},
+		{"a generator", Read("(let g (make-gen '(a b c)) (list (g) (g) (g) (g)))"), env, Read("(a b c done)")[0]},
+		{"backtracking", Read(`
+(let a (choose '(1 2 3))
+  (let b (choose '(4 5 6))
+    (if (= (* a b) 10) (list a b) (fail))))`), env, Read("(2 5)")[0]},
+		{"coroutines", Read(`
+(set out nil)
+(spawn (fn () (worker 'a 2)))
+(spawn (fn () (worker 'b 3)))
+(run-all)
+out`), env, Read("((a 2) (b 3) (a 1) (b 2) (b 1))")[0]},
+	}
+	testEvalCases(cases, t)
+
+	t.Run("resumed from a later expression", func(t *testing.T) {
+		env := GlobalEnv()
+		got, err := Eval(Read(`
+(set n 0)
+(set r (+ 100 (ccc (fn (k) (set saved k) 0))))
+(set n (+ n 1))
+(if (id n 1) (saved 5) r)`), env)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !Equal(got, Int(105)) {
+			t.Errorf("Expected 105 but got %v", got)
+		}
+	})
+
+	t.Run("errors after resuming", func(t *testing.T) {
+		_, err := Eval(Read("(list (car (ccc (fn (k) (set k2 k) '(a)))) (k2 'b))"), env)
+		e, ok := err.(*BelError)
+		if !ok || e.Kind != TypeError {
+			t.Fatalf("Expected a type error but got %v", err)
+		}
+		want := []Value{Read("(car (ccc (fn (k) (set k2 k) '(a))))")[0], Read("(list (car (ccc (fn (k) (set k2 k) '(a)))) (k2 'b))")[0]}
+		if len(e.Stack) != len(want) || !Equal(e.Stack[0], want[0]) || !Equal(e.Stack[1], want[1]) {
+			t.Errorf("Expected the stack %v but got %v", want, e.Stack)
+		}
+	})
+}
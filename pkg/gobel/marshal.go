@@ -0,0 +1,248 @@
+package gobel
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Marshal converts a Go value to Bel data. It converts values the same way
+// Define converts results, so numbers become numbers, strings become strings,
+// slices and arrays become lists, maps become tables, and nil pointers become
+// nil.
+//
+// A struct becomes an association list from the names of its exported fields,
+// as symbols, to their values. The name can be changed with a bel struct tag:
+//
+//	Port int `bel:"port"`           // written as (port . 8080)
+//	Tags []string `bel:",omitempty"` // left out if it's empty
+//	Secret string `bel:"-"`          // never written
+//
+// The fields of an embedded struct are written as if they were fields of the
+// outer struct, unless the outer struct has a field of the same name.
+func Marshal(v interface{}) (Value, error) {
+	return fromGo(reflect.ValueOf(v))
+}
+
+// Unmarshal stores Bel data in the value that dst points to, converting it the
+// way Define converts arguments. It is the reverse of Marshal.
+//
+// A struct is filled in from an association list or a table. Keys are symbols
+// or strings, and are matched to field names, or the names in bel tags,
+// preferring an exact match but otherwise ignoring case. Keys that don't match
+// a field are ignored, and fields that no key matches are left as they were.
+// Pointers are allocated as they are needed, and set to nil by nil.
+func Unmarshal(v Value, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Unmarshal needs a non-nil pointer, not %T", dst)
+	}
+	return setGo(nil, rv.Elem(), v)
+}
+
+// structField is a field of a struct that is marshalled, which may be
+// promoted from an embedded struct.
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields lists the fields of a struct type that are marshalled, in the
+// order they are declared.
+func structFields(t reflect.Type) []structField {
+	fields := collectFields(t, map[reflect.Type]bool{})
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i].index, fields[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return fields
+}
+
+func collectFields(t reflect.Type, visiting map[reflect.Type]bool) []structField {
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	var fields []structField
+	var embedded []reflect.StructField
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("bel")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if comma := strings.IndexByte(tag, ','); comma != -1 {
+			name, opts = tag[:comma], tag[comma+1:]
+		}
+		if f.Anonymous && name == "" && embeddedStruct(f.Type) != nil {
+			embedded = append(embedded, f)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[name] = true
+		fields = append(fields, structField{name, []int{i}, opts == "omitempty"})
+	}
+	// promoted fields are hidden by the struct's own fields of the same name
+	for _, e := range embedded {
+		et := embeddedStruct(e.Type)
+		if visiting[et] {
+			continue
+		}
+		for _, f := range collectFields(et, visiting) {
+			if names[f.name] {
+				continue
+			}
+			names[f.name] = true
+			f.index = append([]int{e.Index[0]}, f.index...)
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// embeddedStruct is the struct type of an embedded field of type t, or nil if
+// it isn't a struct or a pointer to one.
+func embeddedStruct(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// marshalStruct converts a struct to an association list.
+func marshalStruct(v reflect.Value, visiting map[goRef]bool) (Value, error) {
+	var items []Value
+	for _, f := range structFields(v.Type()) {
+		fv, ok := fieldToGet(v, f.index)
+		if !ok || (f.omitEmpty && fv.IsZero()) {
+			continue
+		}
+		x, err := goToBel(fv, visiting)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.name, err)
+		}
+		items = append(items, cons(Intern(f.name), x))
+	}
+	return listOf(items...), nil
+}
+
+// fieldToGet finds a field of v from its index. It reports false if the field
+// is in an embedded struct that a nil pointer stands in for.
+func fieldToGet(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, n := range index {
+		if i > 0 {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}, false
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(n)
+	}
+	return v, true
+}
+
+// fieldToSet finds a field of v from its index, allocating any embedded
+// structs on the way that a nil pointer stands in for.
+func fieldToSet(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, n := range index {
+		if i > 0 {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					if !v.CanSet() {
+						return reflect.Value{}, fmt.Errorf("can't set the embedded pointer to unexported %s", v.Type().Elem())
+					}
+					v.Set(reflect.New(v.Type().Elem()))
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(n)
+	}
+	return v, nil
+}
+
+// setStruct fills in the fields of dst from an association list or table.
+func setStruct(caller *machine, dst reflect.Value, v Value) error {
+	var kvs []tableEntry
+	if t, ok := v.(*Table); ok {
+		kvs = t.entries
+	} else {
+		l, ok := properList(v)
+		if !ok {
+			return fmt.Errorf("%s is not an association list or a table", toString(v))
+		}
+		for ; l != Nil; l = cdrPair(l) {
+			kv, ok := l.First.(*Pair)
+			if !ok || kv == Nil {
+				return fmt.Errorf("%s is not an association list or a table", toString(v))
+			}
+			kvs = append(kvs, tableEntry{kv.First, kv.Rest})
+		}
+	}
+
+	fields := structFields(dst.Type())
+	set := make(map[string]bool)
+	for _, kv := range kvs {
+		name, ok := keyName(kv.key)
+		if !ok {
+			return fmt.Errorf("%s is not the name of a field", toString(kv.key))
+		}
+		f := findField(fields, name)
+		// as with assoc, the first entry for a key is the one that counts
+		if f == nil || set[f.name] {
+			continue
+		}
+		set[f.name] = true
+		fv, err := fieldToSet(dst, f.index)
+		if err != nil {
+			return err
+		}
+		if err := setGo(caller, fv, kv.value); err != nil {
+			return fmt.Errorf("%s: %v", f.name, err)
+		}
+	}
+	return nil
+}
+
+// keyName is the field name a key in an association list stands for.
+func keyName(k Value) (string, bool) {
+	if s, ok := k.(*Symbol); ok {
+		return s.name, true
+	}
+	if isNil(k) {
+		return "", false
+	}
+	return goString(k)
+}
+
+func findField(fields []structField, name string) *structField {
+	for i := range fields {
+		if fields[i].name == name {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, name) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package gobel
+
+import (
+	"reflect"
+	"testing"
+)
+
+type Address struct {
+	Street string `bel:"street"`
+	Town   string `bel:"town"`
+}
+
+type Base struct {
+	ID   int    `bel:"id"`
+	Name string `bel:"name"`
+}
+
+type Server struct {
+	Base
+	*Address
+	Name    string   `bel:"name"`
+	Port    int      `bel:"port"`
+	Ratio   float64  `bel:"ratio"`
+	Tags    []string `bel:"tags,omitempty"`
+	Backup  *Server  `bel:"backup"`
+	Enabled bool
+	Secret  string `bel:"-"`
+	private int
+}
+
+func TestMarshal(t *testing.T) {
+	t.Run("structs", func(t *testing.T) {
+		s := Server{
+			Base:    Base{ID: 7, Name: "hidden"},
+			Address: &Address{Street: "High St", Town: "Bath"},
+			Name:    "web",
+			Port:    8080,
+			Ratio:   0.25,
+			Enabled: true,
+			Secret:  "xyzzy",
+			private: 1,
+		}
+		got, err := Marshal(s)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		want := Read(`((id . 7) (street . "High St") (town . "Bath") (name . "web") (port . 8080) (ratio . 1/4) (backup) (Enabled . t))`)[0]
+		if !Equal(got, want) {
+			t.Errorf("Expected %v but got %v", want, got)
+		}
+	})
+
+	t.Run("pointers and nil embedded structs", func(t *testing.T) {
+		got, err := Marshal(&Server{Name: "db", Tags: []string{"a"}, Backup: &Server{Name: "db2"}})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		want := Read(`((id . 0) (name . "db") (port . 0) (ratio . 0) (tags "a") (backup (id . 0) (name . "db2") (port . 0) (ratio . 0) (backup) (Enabled)) (Enabled))`)[0]
+		if !Equal(got, want) {
+			t.Errorf("Expected %v but got %v", want, got)
+		}
+	})
+
+	t.Run("values it can't convert", func(t *testing.T) {
+		if _, err := Marshal(struct{ C chan int }{}); err == nil {
+			t.Errorf("Expected an error marshalling a channel")
+		}
+	})
+
+	t.Run("values that refer to themselves", func(t *testing.T) {
+		s := &Server{Name: "loop"}
+		s.Backup = s
+		if _, err := Marshal(s); err == nil {
+			t.Errorf("Expected an error marshalling a pointer to itself")
+		}
+		m := map[string]interface{}{}
+		m["m"] = m
+		if _, err := Marshal(m); err == nil {
+			t.Errorf("Expected an error marshalling a map that contains itself")
+		}
+	})
+
+	t.Run("the same pointer twice", func(t *testing.T) {
+		a := &Address{Street: "High St", Town: "Bath"}
+		got, err := Marshal([]*Address{a, a})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		want := Read(`(((street . "High St") (town . "Bath")) ((street . "High St") (town . "Bath")))`)[0]
+		if !Equal(got, want) {
+			t.Errorf("Expected %v but got %v", want, got)
+		}
+	})
+}
+
+func TestUnmarshal(t *testing.T) {
+	t.Run("structs", func(t *testing.T) {
+		s := Server{Port: 80, Secret: "kept"}
+		err := Unmarshal(Read(`((name . "web") (PORT . 8080) (ratio . 1/2) (tags "a" "b") (town . "Bath") (id . 3) (enabled . t) (unknown . 1) (name . "ignored"))`)[0], &s)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		want := Server{
+			Base:    Base{ID: 3},
+			Address: &Address{Town: "Bath"},
+			Name:    "web",
+			Port:    8080,
+			Ratio:   0.5,
+			Tags:    []string{"a", "b"},
+			Enabled: true,
+			Secret:  "kept",
+		}
+		if !reflect.DeepEqual(want, s) {
+			t.Errorf("Expected %+v but got %+v", want, s)
+		}
+	})
+
+	t.Run("tables and string keys", func(t *testing.T) {
+		var a Address
+		tab, err := Eval(Read(`(table '(("street" . "Low St")))`), GlobalEnv())
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if err := Unmarshal(tab, &a); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if a.Street != "Low St" {
+			t.Errorf("Expected Low St but got %q", a.Street)
+		}
+	})
+
+	t.Run("pointers", func(t *testing.T) {
+		s := &Server{Backup: &Server{Name: "old"}}
+		if err := Unmarshal(Read(`((backup (name . "new")))`)[0], &s); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if s.Backup == nil || s.Backup.Name != "new" {
+			t.Errorf("Expected a backup called new but got %+v", s.Backup)
+		}
+		if err := Unmarshal(Read(`((backup))`)[0], s); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if s.Backup != nil {
+			t.Errorf("Expected no backup but got %+v", s.Backup)
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		in := Server{Name: "web", Port: 1, Tags: []string{"x"}, Backup: &Server{Name: "b"}, Address: &Address{Town: "Bath"}}
+		v, err := Marshal(in)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		var out Server
+		if err := Unmarshal(v, &out); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("Expected %+v but got %+v", in, out)
+		}
+	})
+
+	t.Run("big integers", func(t *testing.T) {
+		type limits struct {
+			U   uint64
+			I   int64
+			Neg int64
+		}
+		in := limits{U: 1 << 63, I: 1<<63 - 1, Neg: -1 << 63}
+		v, err := Marshal(in)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		var out limits
+		if err := Unmarshal(v, &out); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if in != out {
+			t.Errorf("Expected %+v but got %+v", in, out)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			name string
+			data string
+			dst  interface{}
+			msg  string
+		}{
+			{"not a pointer", "1", Server{}, "Unmarshal needs a non-nil pointer, not gobel.Server"},
+			{"not an association list", "(a b)", &Server{}, "(a b) is not an association list or a table"},
+			{"the wrong type of field", `((port . "80"))`, &Server{}, `port: "80" is not an integer that fits in int`},
+			{"a nested field", "((backup (port . a)))", &Server{}, "backup: port: a is not an integer that fits in int"},
+			{"a key that isn't a name", "((1 . 2))", &Server{}, "1 is not the name of a field"},
+			{"too big for an int", "((port . 9223372036854775808))", &Server{}, "port: 9223372036854775808 is not an integer that fits in int"},
+			{"too big for a uint64", "((U . 18446744073709551616))", &struct{ U uint64 }{}, "U: 18446744073709551616 is not an integer that fits in uint64"},
+			{"a negative uint", "((U . -1))", &struct{ U uint }{}, "U: -1 is not an integer that fits in uint"},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				err := Unmarshal(Read(c.data)[0], c.dst)
+				if err == nil || err.Error() != c.msg {
+					t.Errorf("Expected the error %q but got %v", c.msg, err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package gobel
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Bel numbers are exact. Integers that fit in a Go int are an Int, anything
+// bigger is a *BigInt and fractions are a *Rat. Every operation hands back the
+// smallest of those that can hold its result, so that an Int is always an Int
+// however it was arrived at.
+
+const (
+	maxInt = int(^uint(0) >> 1)
+	minInt = -maxInt - 1
+)
+
+// parseNumber reads an integer or a ratio such as -3/4. The second result is
+// false if s doesn't look like a number at all.
+func parseNumber(s string) (Value, bool, error) {
+	if i, err := strconv.Atoi(s); err == nil {
+		return Int(i), true, nil
+	}
+	num, denom := s, ""
+	if slash := strings.IndexByte(s, '/'); slash != -1 {
+		num, denom = s[:slash], s[slash+1:]
+		if !isDigits(denom) {
+			return nil, false, nil
+		}
+	}
+	if !isInteger(num) {
+		return nil, false, nil
+	}
+	n, _ := new(big.Int).SetString(num, 10)
+	if denom == "" {
+		return normalizeInt(n), true, nil
+	}
+	d, _ := new(big.Int).SetString(denom, 10)
+	if d.Sign() == 0 {
+		return nil, true, fmt.Errorf("%s divides by zero", s)
+	}
+	return normalizeRat(new(big.Rat).SetFrac(n, d)), true, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isInteger(s string) bool {
+	return isDigits(strings.TrimPrefix(s, "-"))
+}
+
+func isNumber(v Value) bool {
+	switch v.(type) {
+	case Int, *BigInt, *Rat:
+		return true
+	}
+	return false
+}
+
+func normalizeInt(n *big.Int) Value {
+	if n.IsInt64() && n.Int64() >= int64(minInt) && n.Int64() <= int64(maxInt) {
+		return Int(n.Int64())
+	}
+	return (*BigInt)(n)
+}
+
+func normalizeRat(r *big.Rat) Value {
+	if r.IsInt() {
+		return normalizeInt(new(big.Int).Set(r.Num()))
+	}
+	return (*Rat)(r)
+}
+
+func toRat(v Value) (*big.Rat, error) {
+	switch n := v.(type) {
+	case Int:
+		return new(big.Rat).SetInt64(int64(n)), nil
+	case *BigInt:
+		return new(big.Rat).SetInt(n.big()), nil
+	case *Rat:
+		return n.big(), nil
+	}
+	return nil, belErrorf(TypeError, "%s is not a number", toString(v))
+}
+
+func add(a, b Value) (Value, error) {
+	if x, ok := a.(Int); ok {
+		if y, ok := b.(Int); ok {
+			if sum := x + y; (sum > x) == (y > 0) {
+				return sum, nil
+			}
+		}
+	}
+	return ratOp(a, b, (*big.Rat).Add)
+}
+
+func sub(a, b Value) (Value, error) {
+	if x, ok := a.(Int); ok {
+		if y, ok := b.(Int); ok {
+			if diff := x - y; (diff < x) == (y > 0) {
+				return diff, nil
+			}
+		}
+	}
+	return ratOp(a, b, (*big.Rat).Sub)
+}
+
+func mul(a, b Value) (Value, error) {
+	if x, ok := a.(Int); ok {
+		if y, ok := b.(Int); ok {
+			if x == 0 || y == 0 {
+				return Int(0), nil
+			}
+			product := x * y
+			if product/y == x && !(x == -1 && y == Int(minInt)) && !(y == -1 && x == Int(minInt)) {
+				return product, nil
+			}
+		}
+	}
+	return ratOp(a, b, (*big.Rat).Mul)
+}
+
+func div(a, b Value) (Value, error) {
+	y, err := toRat(b)
+	if err != nil {
+		return nil, err
+	}
+	if y.Sign() == 0 {
+		return nil, errors.New("division by zero")
+	}
+	return ratOp(a, b, (*big.Rat).Quo)
+}
+
+func ratOp(a, b Value, op func(z, x, y *big.Rat) *big.Rat) (Value, error) {
+	x, err := toRat(a)
+	if err != nil {
+		return nil, err
+	}
+	y, err := toRat(b)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeRat(op(new(big.Rat), x, y)), nil
+}
+
+// expt raises base to an integer power.
+func expt(base, power Value) (Value, error) {
+	b, err := toRat(base)
+	if err != nil {
+		return nil, err
+	}
+	p, err := toRat(power)
+	if err != nil {
+		return nil, err
+	}
+	if !p.IsInt() {
+		return nil, fmt.Errorf("cannot raise to the fractional power %s", toString(power))
+	}
+	e := new(big.Int).Abs(p.Num())
+	if b.Sign() == 0 && p.Sign() < 0 {
+		return nil, errors.New("division by zero")
+	}
+	num := new(big.Int).Exp(b.Num(), e, nil)
+	denom := new(big.Int).Exp(b.Denom(), e, nil)
+	if p.Sign() < 0 {
+		num, denom = denom, num
+	}
+	return normalizeRat(new(big.Rat).SetFrac(num, denom)), nil
+}
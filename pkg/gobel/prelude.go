@@ -0,0 +1,32 @@
+package gobel
+
+import (
+	_ "embed"
+	"fmt"
+	"sync"
+)
+
+//go:embed prelude.bel
+var preludeSource string
+
+var (
+	preludeOnce        sync.Once
+	preludeExpressions []Value
+)
+
+// loadPrelude evaluates the Bel definitions in prelude.bel in env. The source is
+// only read once, however many environments are made.
+func loadPrelude(env *Env) {
+	preludeOnce.Do(func() {
+		var err error
+		preludeExpressions, err = Parse("prelude.bel", preludeSource)
+		if err != nil {
+			panic(err)
+		}
+	})
+	for _, e := range preludeExpressions {
+		if _, err := eval(nil, e, env); err != nil {
+			panic(fmt.Sprintf("prelude.bel: %v", err))
+		}
+	}
+}
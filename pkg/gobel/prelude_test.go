@@ -0,0 +1,75 @@
+package gobel
+
+import "testing"
+
+func TestPrelude(t *testing.T) {
+	t.Run("predicates", func(t *testing.T) {
+		cases := []evalCase{
+			{"no nil", Read("(no nil)"), GlobalEnv(), Intern("t")},
+			{"no t", Read("(no t)"), GlobalEnv(), Nil},
+			{"atom", Read("(atom 'a)"), GlobalEnv(), Intern("t")},
+			{"atom of a pair", Read("(atom '(a))"), GlobalEnv(), Nil},
+			{"all", Read("(all atom '(a b))"), GlobalEnv(), Intern("t")},
+			{"not all", Read("(all atom '(a (b)))"), GlobalEnv(), Nil},
+			{"some", Read("(some atom '((a) b c))"), GlobalEnv(), Read("(b c)")[0]},
+			{"not some", Read("(some atom '((a)))"), GlobalEnv(), Nil},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("lists", func(t *testing.T) {
+		cases := []evalCase{
+			{"reduce", Read("(reduce join '(a b c))"), GlobalEnv(), Read("(a b . c)")[0]},
+			{"cons", Read("(cons 'a 'b '(c))"), GlobalEnv(), Read("(a b c)")[0]},
+			{"append", Read("(append '(a b) nil '(c) '(d e))"), GlobalEnv(), Read("(a b c d e)")[0]},
+			{"append with nothing", Read("(append)"), GlobalEnv(), Nil},
+			{"rev", Read("(rev '(a b c))"), GlobalEnv(), Read("(c b a)")[0]},
+			{"snoc", Read("(snoc '(a b) 'c 'd)"), GlobalEnv(), Read("(a b c d)")[0]},
+			{"list", Read("(list 'a (list))"), GlobalEnv(), Read("(a nil)")[0]},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("map", func(t *testing.T) {
+		cases := []evalCase{
+			{"one list", Read("(map car '((a b) (c d)))"), GlobalEnv(), Read("(a c)")[0]},
+			{"several lists", Read("(map + '(1 2 3) '(10 20 30))"), GlobalEnv(), Read("(11 22 33)")[0]},
+			{"stops at the shortest list", Read("(map join '(a b c) '(1 2))"), GlobalEnv(), Read("((a . 1) (b . 2))")[0]},
+			{"brackets", Read("(map [+ _ 1] '(1 2))"), GlobalEnv(), Read("(2 3)")[0]},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("definitions", func(t *testing.T) {
+		cases := []evalCase{
+			{"def", Read("(def double (x) (+ x x)) (double 4)"), GlobalEnv(), Int(8)},
+			{"fn with a body", Read("((fn (x) (set y x) (+ y 1)) 1)"), GlobalEnv(), Int(2)},
+			{"mac", Read("(mac unless (test . body) `(if ,test nil (do ,@body))) (unless nil 1 2)"), GlobalEnv(), Int(2)},
+			{"macro arguments are not evaluated", Read("(mac q (x) `',x) (q (a b))"), GlobalEnv(), Read("(a b)")[0]},
+			{"do", Read("(do (set x 1) (+ x 1))"), GlobalEnv(), Int(2)},
+			{"let", Read("(let x 2 (+ x 1))"), GlobalEnv(), Int(3)},
+			{"let destructures", Read("(let (a . b) '(1 2 3) b)"), GlobalEnv(), Read("(2 3)")[0]},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("parameters", func(t *testing.T) {
+		cases := []evalCase{
+			{"nested", Read("((fn ((a b) c) (list a b c)) '(1 2) 3)"), GlobalEnv(), Read("(1 2 3)")[0]},
+			{"rest", Read("((fn (a . b) b) 1 2 3)"), GlobalEnv(), Read("(2 3)")[0]},
+			{"optional given", Read("((fn (a (o b 5)) (+ a b)) 1 2)"), GlobalEnv(), Int(3)},
+			{"optional left out", Read("((fn (a (o b 5)) (+ a b)) 1)"), GlobalEnv(), Int(6)},
+			{"optional without a default", Read("((fn ((o a)) a))"), GlobalEnv(), Nil},
+			{"default uses earlier parameters", Read("((fn (a (o b a)) (list a b)) 1)"), GlobalEnv(), Read("(1 1)")[0]},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("parameter errors", func(t *testing.T) {
+		for _, program := range []string{"((fn (a b) a) 1)", "((fn (a) a) 1 2)", "((fn ((a)) a) 1)"} {
+			if _, err := Eval(Read(program), GlobalEnv()); err == nil {
+				t.Errorf("Expected an error from %s", program)
+			}
+		}
+	})
+}
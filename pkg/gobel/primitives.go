@@ -0,0 +1,207 @@
+package gobel
+
+import (
+	"math/rand"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// primitive makes a NativeProcedure out of one of Bel's primitives, which take
+// a fixed number of arguments. As in Bel, any arguments left out are nil, and
+// passing too many is an error.
+func primitive(name string, arity int, fn func(args []Value) (Value, error)) *NativeProcedure {
+	return &NativeProcedure{application: func(l *Pair) (Value, error) {
+		args, err := fixedArgs(name, arity, l)
+		if err != nil {
+			return nil, err
+		}
+		return fn(args)
+	}}
+}
+
+// fixedArgs is the arity arguments in l, with nil for any that are left out.
+func fixedArgs(name string, arity int, l *Pair) ([]Value, error) {
+	args := make([]Value, arity)
+	for i := range args {
+		args[i] = Nil
+	}
+	for i := 0; l != Nil; i, l = i+1, cdrPair(l) {
+		if i == arity {
+			return nil, belErrorf(ArityError, "overargs: too many arguments to %s", name)
+		}
+		args[i] = l.First
+	}
+	return args, nil
+}
+
+// minArgs checks that l has at least n arguments for name.
+func minArgs(name string, n int, l *Pair) error {
+	for ; n > 0; n, l = n-1, cdrPair(l) {
+		if l == Nil {
+			return belErrorf(ArityError, "underargs: too few arguments to %s", name)
+		}
+	}
+	return nil
+}
+
+// definePrimitives binds the primitives of Bel's axioms, and the symbols that
+// evaluate to themselves, in env.
+func definePrimitives(env *Env) {
+	for _, name := range []string{"t", "o", "apply"} {
+		env.set(name, Intern(name))
+	}
+	env.set("nil", Nil)
+
+	env.set("id", primitive("id", 2, func(args []Value) (Value, error) {
+		return truth(id(args[0], args[1])), nil
+	}))
+
+	env.set("=", &NativeProcedure{application: func(l *Pair) (Value, error) {
+		for ; l != Nil && cdrPair(l) != Nil; l = cdrPair(l) {
+			if !Equal(l.First, cdrPair(l).First) {
+				return Nil, nil
+			}
+		}
+		return Intern("t"), nil
+	}})
+
+	env.set("join", primitive("join", 2, func(args []Value) (Value, error) {
+		return cons(args[0], args[1]), nil
+	}))
+
+	env.set("car", primitive("car", 1, func(args []Value) (Value, error) {
+		p, ok := args[0].(*Pair)
+		if !ok {
+			return nil, belErrorf(TypeError, "car-on-atom: %s", toString(args[0]))
+		}
+		return car(p), nil
+	}))
+
+	env.set("cdr", primitive("cdr", 1, func(args []Value) (Value, error) {
+		p, ok := args[0].(*Pair)
+		if !ok {
+			return nil, belErrorf(TypeError, "cdr-on-atom: %s", toString(args[0]))
+		}
+		return cdr(p), nil
+	}))
+
+	env.set("type", primitive("type", 1, func(args []Value) (Value, error) {
+		return typeOf(args[0])
+	}))
+
+	env.set("xar", primitive("xar", 2, func(args []Value) (Value, error) {
+		p, ok := args[0].(*Pair)
+		if !ok || p == Nil {
+			return nil, belErrorf(TypeError, "xar-on-atom: %s", toString(args[0]))
+		}
+		p.First = args[1]
+		return args[1], nil
+	}))
+
+	env.set("xdr", primitive("xdr", 2, func(args []Value) (Value, error) {
+		p, ok := args[0].(*Pair)
+		if !ok || p == Nil {
+			return nil, belErrorf(TypeError, "xdr-on-atom: %s", toString(args[0]))
+		}
+		p.Rest = args[1]
+		return args[1], nil
+	}))
+
+	env.set("sym", primitive("sym", 1, func(args []Value) (Value, error) {
+		s, ok := goString(args[0])
+		if !ok {
+			return nil, belErrorf(TypeError, "sym: %s is not a string", toString(args[0]))
+		}
+		if s == "nil" {
+			return Nil, nil
+		}
+		return Intern(s), nil
+	}))
+
+	env.set("nom", primitive("nom", 1, func(args []Value) (Value, error) {
+		if isNil(args[0]) {
+			return belString("nil"), nil
+		}
+		s, ok := args[0].(*Symbol)
+		if !ok {
+			return nil, belErrorf(TypeError, "nom: %s is not a symbol", toString(args[0]))
+		}
+		return belString(s.name), nil
+	}))
+
+	env.set("coin", primitive("coin", 0, func([]Value) (Value, error) {
+		return truth(rand.Intn(2) == 0), nil
+	}))
+
+	env.set("sys", primitive("sys", 1, func(args []Value) (Value, error) {
+		command, ok := goString(args[0])
+		if !ok {
+			return nil, belErrorf(TypeError, "sys: %s is not a string", toString(args[0]))
+		}
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return nil, belErrorf(OtherError, "sys: %v", err)
+		}
+		return Nil, nil
+	}))
+}
+
+// spread picks apart the arguments to apply, f a b xs, into the function f and
+// the arguments it's called with, a, b and then each of the elements of xs.
+func spread(l *Pair) (Value, *Pair, error) {
+	if l == Nil {
+		return nil, nil, belErrorf(ArityError, "apply needs a function to apply")
+	}
+	var items []Value
+	for rest := cdrPair(l); rest != Nil; rest = cdrPair(rest) {
+		items = append(items, rest.First)
+	}
+	if len(items) == 0 {
+		return l.First, Nil, nil
+	}
+	last, ok := properList(items[len(items)-1])
+	if !ok {
+		return nil, nil, belErrorf(TypeError, "apply: %s is not a list", toString(items[len(items)-1]))
+	}
+	args := last
+	for i := len(items) - 2; i >= 0; i-- {
+		args = cons(items[i], args)
+	}
+	return l.First, args, nil
+}
+
+// typeOf is the type of x as Bel's type primitive gives it. Bel's own numbers
+// and functions are lists, but gobel's aren't, so they get types of their own.
+func typeOf(x Value) (Value, error) {
+	if x == nil {
+		return nil, belErrorf(TypeError, "type: no value")
+	}
+	return x.Type(), nil
+}
+
+// belString makes a Bel string, a list of characters, out of s.
+func belString(s string) *Pair {
+	rs := []rune(s)
+	p := Nil
+	for i := len(rs) - 1; i > -1; i-- {
+		p = cons(Char(rs[i]), p)
+	}
+	return p
+}
+
+// goString turns a Bel string into a Go one. It reports false if x isn't a
+// proper list of characters.
+func goString(x Value) (string, bool) {
+	var s strings.Builder
+	p, ok := x.(*Pair)
+	for ; ok && p != Nil; p, ok = p.Rest.(*Pair) {
+		c, isChar := p.First.(Char)
+		if !isChar {
+			return "", false
+		}
+		s.WriteRune(rune(c))
+	}
+	return s.String(), ok
+}
@@ -0,0 +1,105 @@
+package gobel
+
+import (
+	"testing"
+)
+
+func TestPrimitives(t *testing.T) {
+	t.Run("self-evaluating symbols", func(t *testing.T) {
+		cases := []evalCase{
+			{"t", Read("t"), GlobalEnv(), Intern("t")},
+			{"nil", Read("nil"), GlobalEnv(), Nil},
+			{"o", Read("o"), GlobalEnv(), Intern("o")},
+			{"apply", Read("apply"), GlobalEnv(), Intern("apply")},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("pairs", func(t *testing.T) {
+		cases := []evalCase{
+			{"join", Read("(join 'a 'b)"), GlobalEnv(), &Pair{Intern("a"), Intern("b")}},
+			{"join with nothing", Read("(join)"), GlobalEnv(), &Pair{Nil, Nil}},
+			{"join one", Read("(join 'a)"), GlobalEnv(), &Pair{Intern("a"), Nil}},
+			{"car", Read("(car '(a b))"), GlobalEnv(), Intern("a")},
+			{"car of nil", Read("(car nil)"), GlobalEnv(), Nil},
+			{"cdr", Read("(cdr '(a b))"), GlobalEnv(), Read("(b)")[0]},
+			{"cdr of nil", Read("(cdr nil)"), GlobalEnv(), Nil},
+			{"xar", Read("(set x '(a b)) (xar x 'c) x"), GlobalEnv(), Read("(c b)")[0]},
+			{"xar returns the new value", Read("(xar '(a b) 'c)"), GlobalEnv(), Intern("c")},
+			{"xdr", Read("(set x '(a b)) (xdr x 'c) x"), GlobalEnv(), Read("(a . c)")[0]},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("type", func(t *testing.T) {
+		cases := []evalCase{
+			{"symbol", Read("(type 'a)"), GlobalEnv(), Intern("symbol")},
+			{"nil", Read("(type nil)"), GlobalEnv(), Intern("symbol")},
+			{"pair", Read("(type '(a))"), GlobalEnv(), Intern("pair")},
+			{"string", Read(`(type "abc")`), GlobalEnv(), Intern("pair")},
+			{"char", Read(`(type \a)`), GlobalEnv(), Intern("char")},
+			{"number", Read("(type 1/2)"), GlobalEnv(), Intern("number")},
+			{"primitive", Read("(type car)"), GlobalEnv(), Intern("fn")},
+			{"function", Read("(type (fn (x) x))"), GlobalEnv(), Intern("fn")},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("symbols and strings", func(t *testing.T) {
+		cases := []evalCase{
+			{"sym", Read(`(sym "foo")`), GlobalEnv(), Intern("foo")},
+			{"sym interns", Read(`(id (sym "foo") 'foo)`), GlobalEnv(), Intern("t")},
+			{"sym of nil", Read(`(sym "nil")`), GlobalEnv(), Nil},
+			{"nom", Read("(nom 'foo)"), GlobalEnv(), belString("foo")},
+			{"nom of nil", Read("(nom nil)"), GlobalEnv(), belString("nil")},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		cases := []evalCase{
+			{"list of arguments", Read("(apply + '(1 2 3))"), GlobalEnv(), Int(6)},
+			{"arguments before the list", Read("(apply + 1 2 '(3 4))"), GlobalEnv(), Int(10)},
+			{"no arguments", Read("(apply +)"), GlobalEnv(), Int(0)},
+			{"a procedure", Read("(apply (fn (x y) (join y x)) '(a b))"), GlobalEnv(), &Pair{Intern("b"), Intern("a")}},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("coin", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			if got, _ := Eval(Read("(coin)"), GlobalEnv()); got != Intern("t") && got != Nil {
+				t.Fatalf("Expected t or nil but got %v", got)
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			name    string
+			program string
+			kind    ErrorKind
+		}{
+			{"car of an atom", "(car 'a)", TypeError},
+			{"cdr of an atom", "(cdr 1)", TypeError},
+			{"xar of nil", "(xar nil 'a)", TypeError},
+			{"xdr of an atom", `(xdr \a 'a)`, TypeError},
+			{"sym of a symbol", "(sym 'a)", TypeError},
+			{"nom of a string", `(nom "a")`, TypeError},
+			{"too many arguments", "(car '(a) '(b))", ArityError},
+			{"apply to an atom", "(apply + 1)", TypeError},
+			{"rdb from something that is not a stream", "(rdb 'a)", TypeError},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				got, err := Eval(Read(c.program), GlobalEnv())
+				if err == nil {
+					t.Fatalf("Expected an error from %s but got %v", c.program, got)
+				}
+				if e, ok := err.(*BelError); !ok || e.Kind != c.kind {
+					t.Errorf("Expected a %s error from %s but got %#v", c.kind, c.program, err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package gobel
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// ReadMacro reads a piece of syntax. It's called with the lexer on the token
+// that set it off, and must leave the lexer on the first token after the
+// syntax it reads. Use Reader.ReadDatum to read any expressions inside it.
+//
+// Errors that aren't already a *ParseError are reported at the token that set
+// the macro off.
+type ReadMacro func(r *Reader, toks Lexer) (Value, error)
+
+// Readtable says what the reader does with each token. A token whose first
+// character has a macro is read by that macro, and a token that starts with #
+// is looked up, without the #, in the dispatch macros. Anything else is read
+// as a number or a symbol.
+type Readtable struct {
+	macros   map[rune]ReadMacro
+	dispatch map[string]ReadMacro
+}
+
+// NewReadtable returns a Readtable holding Bel's standard syntax, ready to
+// have more added to it.
+func NewReadtable() *Readtable {
+	rt := &Readtable{
+		macros:   make(map[rune]ReadMacro),
+		dispatch: make(map[string]ReadMacro),
+	}
+	rt.SetMacro('(', readParen)
+	rt.SetMacro('[', readBracket)
+	for _, c := range ")]{}" {
+		rt.SetMacro(c, readUnexpected)
+	}
+	for _, c := range "'`," {
+		rt.SetMacro(c, readPrefix)
+	}
+	rt.SetMacro('"', readString)
+	rt.SetMacro('\\', readChar)
+	rt.SetMacro('#', readDispatch)
+	rt.SetDispatch("table", readTable)
+	return rt
+}
+
+// SetMacro makes m read tokens starting with c.
+func (rt *Readtable) SetMacro(c rune, m ReadMacro) {
+	rt.macros[c] = m
+}
+
+// SetDispatch makes m read the token #name. The lexer splits tokens at
+// brackets, braces, quotes and whitespace, so #name can be followed directly
+// by a string or a bracketed form, as in #re"a+" or #json{"a" 1}.
+func (rt *Readtable) SetDispatch(name string, m ReadMacro) {
+	rt.dispatch[name] = m
+}
+
+// BelReadMacro returns a ReadMacro that reads the expression after the token
+// that set it off and calls the Bel function fn on it, so #name x reads as
+// whatever (fn 'x) returns.
+func BelReadMacro(fn Value) ReadMacro {
+	return func(r *Reader, toks Lexer) (Value, error) {
+		toks.Next()
+		e, err := r.ReadDatum()
+		if err != nil {
+			return nil, err
+		}
+		return apply(nil, fn, &Pair{e, Nil})
+	}
+}
+
+// ReadDatum reads the next expression as part of the one currently being read,
+// so it's for use inside a ReadMacro. Unlike ReadExpr it treats running out of
+// input as a *ParseError.
+func (r *Reader) ReadDatum() (Value, error) {
+	e, err := r.readTokens()
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// readMacro reads the current token with the macro for its first character,
+// if there is one.
+func (r *Reader) readMacro() (Value, *ParseError, bool) {
+	toks := r.toks
+	c, _ := utf8.DecodeRuneInString(toks.Current())
+	m, ok := r.Readtable.macros[c]
+	if !ok {
+		return nil, nil, false
+	}
+	v, err := r.callMacro(m)
+	return v, err, true
+}
+
+func (r *Reader) callMacro(m ReadMacro) (Value, *ParseError) {
+	toks := r.toks
+	start := parseError(toks, "")
+	v, err := m(r, toks)
+	if err == nil {
+		return v, nil
+	}
+	if perr, ok := err.(*ParseError); ok {
+		return nil, perr
+	}
+	start.Msg = err.Error()
+	return nil, start
+}
+
+func readParen(r *Reader, toks Lexer) (Value, error) {
+	toks.Next()
+	l, err := r.readList(")")
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func readBracket(r *Reader, toks Lexer) (Value, error) {
+	toks.Next()
+	body, err := r.readList("]")
+	if err != nil {
+		return nil, err
+	}
+	return bracketFn(body), nil
+}
+
+func readUnexpected(r *Reader, toks Lexer) (Value, error) {
+	return nil, errors.New("unexpected " + toks.Current())
+}
+
+// prefixes are the tokens that wrap the expression following them in a list.
+var prefixes = map[string]string{
+	"'":  "quote",
+	"`":  "bquote",
+	",":  "comma",
+	",@": "comma-at",
+}
+
+func readPrefix(r *Reader, toks Lexer) (Value, error) {
+	name, ok := prefixes[toks.Current()]
+	if !ok {
+		return nil, errors.New("unknown prefix")
+	}
+	toks.Next()
+	e, err := r.ReadDatum()
+	if err != nil {
+		return nil, err
+	}
+	return &Pair{Intern(name), &Pair{e, Nil}}, nil
+}
+
+func readString(r *Reader, toks Lexer) (Value, error) {
+	s, err := aString(toks.Current())
+	if err != nil {
+		return nil, err
+	}
+	toks.Next()
+	return s, nil
+}
+
+func readChar(r *Reader, toks Lexer) (Value, error) {
+	tok := toks.Current()
+	if len(tok) == 1 {
+		return nil, errors.New("missing character after \\")
+	}
+	c, err := charCodeLookup(tok[1:])
+	if err != nil {
+		return nil, err
+	}
+	toks.Next()
+	return Char(c), nil
+}
+
+// readDispatch reads labels and anything with a dispatch macro. Other tokens
+// starting with # are symbols, as they always have been.
+func readDispatch(r *Reader, toks Lexer) (Value, error) {
+	tok := toks.Current()
+	if isLabel(tok) {
+		v, err := r.readLabel()
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	if m, ok := r.Readtable.dispatch[tok[1:]]; ok {
+		v, err := r.callMacro(m)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	v, err := atom(tok)
+	if err != nil {
+		return nil, err
+	}
+	toks.Next()
+	return v, nil
+}
@@ -0,0 +1,135 @@
+package gobel
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReadtable(t *testing.T) {
+	readWith := func(program string, setup func(*Readtable)) (Value, error) {
+		r := NewReader(strings.NewReader(program))
+		r.Filename = "test.bel"
+		setup(r.Readtable)
+		return r.ReadExpr()
+	}
+
+	t.Run("dispatch macro reading a string", func(t *testing.T) {
+		got, err := readWith(`(match #re"a+b" x)`, func(rt *Readtable) {
+			rt.SetDispatch("re", func(r *Reader, toks Lexer) (Value, error) {
+				toks.Next()
+				if !strings.HasPrefix(toks.Current(), `"`) {
+					return nil, errors.New("#re needs a string")
+				}
+				s, err := strconv.Unquote(toks.Current())
+				if err != nil {
+					return nil, err
+				}
+				if _, err := regexp.Compile(s); err != nil {
+					return nil, err
+				}
+				toks.Next()
+				return listOf(Intern("re"), belString(s)), nil
+			})
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if want := Read(`(match (re "a+b") x)`)[0]; !reflect.DeepEqual(want, got) {
+			t.Errorf("Expected %v but got %v", want, got)
+		}
+	})
+
+	t.Run("macro character reading up to a closer", func(t *testing.T) {
+		got, err := readWith(`#json{"a" 1 "b" (2 3)}`, func(rt *Readtable) {
+			rt.SetDispatch("json", func(r *Reader, toks Lexer) (Value, error) {
+				toks.Next()
+				return r.ReadDatum()
+			})
+			rt.SetMacro('{', func(r *Reader, toks Lexer) (Value, error) {
+				toks.Next()
+				var items []Value
+				for toks.Current() != "}" {
+					if toks.End() {
+						return nil, errors.New("unexpected end of input, expected }")
+					}
+					e, err := r.ReadDatum()
+					if err != nil {
+						return nil, err
+					}
+					items = append(items, e)
+				}
+				toks.Next()
+				return &Pair{Intern("obj"), listOf(items...)}, nil
+			})
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		want := Read(`(obj "a" 1 "b" (2 3))`)[0]
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("Expected %v but got %v", want, got)
+		}
+	})
+
+	t.Run("Bel function as a dispatch macro", func(t *testing.T) {
+		fn, err := Eval(Read("(fn (x) (cons 'tagged x))"), GlobalEnv())
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		got, err := readWith("#tag (a b)", func(rt *Readtable) {
+			rt.SetDispatch("tag", BelReadMacro(fn))
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		want := Read("(tagged a b)")[0]
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("Expected %v but got %v", want, got)
+		}
+	})
+
+	t.Run("replacing built-in syntax", func(t *testing.T) {
+		got, err := readWith("'a", func(rt *Readtable) {
+			rt.SetMacro('\'', func(r *Reader, toks Lexer) (Value, error) {
+				toks.Next()
+				e, err := r.ReadDatum()
+				return &Pair{Intern("literally"), &Pair{e, Nil}}, err
+			})
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if want := Read("(literally a)")[0]; !reflect.DeepEqual(want, got) {
+			t.Errorf("Expected %v but got %v", want, got)
+		}
+	})
+
+	t.Run("macro errors are reported where the macro started", func(t *testing.T) {
+		_, err := readWith(`(a #re b)`, func(rt *Readtable) {
+			rt.SetDispatch("re", func(r *Reader, toks Lexer) (Value, error) {
+				return nil, errors.New("#re needs a string")
+			})
+		})
+		perr, ok := err.(*ParseError)
+		if !ok {
+			t.Fatalf("Expected a *ParseError but got %#v", err)
+		}
+		if perr.Pos.Filename != "test.bel" || perr.Pos.Column != 4 || perr.Token != "#re" || perr.Msg != "#re needs a string" {
+			t.Errorf("Expected the error at #re, column 4, but got %v", perr)
+		}
+	})
+
+	t.Run("other # tokens are still symbols", func(t *testing.T) {
+		got, err := readWith("#foo", func(*Readtable) {})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if want := Intern("#foo"); !reflect.DeepEqual(want, got) {
+			t.Errorf("Expected %v but got %v", want, got)
+		}
+	})
+}
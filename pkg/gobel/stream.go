@@ -0,0 +1,314 @@
+package gobel
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// Stream is a Bel stream, which reads or writes a bit at a time. Bits are
+// gathered into bytes, most significant bit first, on their way to and from the
+// underlying io.Reader or io.Writer. Characters are written as the bits of
+// their UTF-8 encoding.
+type Stream struct {
+	in     *bufio.Reader
+	out    io.Writer
+	closer io.Closer
+	closed bool
+	// buf holds the bits of a partly read or written byte, and n is how many
+	// of them there are.
+	buf byte
+	n   int
+	// reader reads expressions from the stream for read, and for anything
+	// else that calls Reader. Once it has been used it may have read ahead of
+	// what rdb will see.
+	reader *Reader
+}
+
+// NewInStream returns a stream that reads from r.
+func NewInStream(r io.Reader) *Stream {
+	return &Stream{in: bufio.NewReader(r)}
+}
+
+// Reader returns the Reader that read uses to read expressions from s. Go code
+// that reads expressions from a stream that Bel code also reads, such as a
+// REPL reading from ins, should use it too, so that neither of them reads ahead
+// into input meant for the other.
+func (s *Stream) Reader() *Reader {
+	if s.reader == nil {
+		s.reader = NewReader(s)
+	}
+	return s.reader
+}
+
+// NewOutStream returns a stream that writes to w.
+func NewOutStream(w io.Writer) *Stream {
+	return &Stream{out: w}
+}
+
+// ReadBit reads the next bit, which is 0 or 1. It returns io.EOF once the
+// input has run out.
+func (s *Stream) ReadBit() (byte, error) {
+	if s.closed {
+		return 0, errors.New("stream is closed")
+	}
+	if s.in == nil {
+		return 0, errors.New("stream is not for reading")
+	}
+	if s.n == 0 {
+		b, err := s.in.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		s.buf, s.n = b, 8
+	}
+	s.n--
+	return (s.buf >> s.n) & 1, nil
+}
+
+// WriteBit writes a bit, 0 or 1. Nothing reaches the underlying writer until a
+// whole byte has been written.
+func (s *Stream) WriteBit(bit byte) error {
+	if s.closed {
+		return errors.New("stream is closed")
+	}
+	if s.out == nil {
+		return errors.New("stream is not for writing")
+	}
+	s.buf = s.buf<<1 | bit&1
+	s.n++
+	if s.n < 8 {
+		return nil
+	}
+	b := s.buf
+	s.buf, s.n = 0, 0
+	_, err := s.out.Write([]byte{b})
+	return err
+}
+
+// Close closes the stream, and the file under it if it was opened with ops.
+// Any bits of a byte that hasn't been finished are lost.
+func (s *Stream) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// ReadByte reads a byte from a stream a bit at a time, so that the reader can
+// read from a stream that's been part read with rdb.
+func (s *Stream) ReadByte() (byte, error) {
+	var b byte
+	for i := 0; i < 8; i++ {
+		bit, err := s.ReadBit()
+		if err != nil {
+			return 0, err
+		}
+		b = b<<1 | bit
+	}
+	return b, nil
+}
+
+func (s *Stream) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b, err := s.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	p[0] = b
+	return 1, nil
+}
+
+func (s *Stream) String() string {
+	return fmt.Sprintf("#[stream %s %v]", s.status().name, unsafe.Pointer(s))
+}
+
+// status is the stream's status as stat gives it: closed, in or out.
+func (s *Stream) status() *Symbol {
+	switch {
+	case s.closed:
+		return Intern("closed")
+	case s.in != nil:
+		return Intern("in")
+	}
+	return Intern("out")
+}
+
+// streamArg is the stream a primitive was given, or a default one if it was
+// given nil.
+func streamArg(name string, x Value, def *Stream) (*Stream, error) {
+	if isNil(x) {
+		return def, nil
+	}
+	s, ok := x.(*Stream)
+	if !ok {
+		return nil, belErrorf(TypeError, "%s: %s is not a stream", name, toString(x))
+	}
+	return s, nil
+}
+
+// bitChar is the character Bel uses for a bit.
+func bitChar(bit byte) Char {
+	return Char('0' + bit)
+}
+
+// defineStreams binds the primitives that work on streams in env, along with
+// the default streams ins and outs, which are nil and so stand for stdin and
+// stdout.
+func defineStreams(env *Env, stdinStream, stdoutStream *Stream) {
+	env.set("ins", Nil)
+	env.set("outs", Nil)
+
+	env.set("wrb", primitive("wrb", 2, func(args []Value) (Value, error) {
+		s, err := streamArg("wrb", args[1], stdoutStream)
+		if err != nil {
+			return nil, belError(err)
+		}
+		c, ok := args[0].(Char)
+		if !ok || (c != '0' && c != '1') {
+			return nil, belErrorf(TypeError, "wrb: %s is not a bit", toString(args[0]))
+		}
+		if err := s.WriteBit(byte(c - '0')); err != nil {
+			return nil, belErrorf(OtherError, "wrb: %v", err)
+		}
+		return c, nil
+	}))
+
+	env.set("rdb", primitive("rdb", 1, func(args []Value) (Value, error) {
+		s, err := streamArg("rdb", args[0], stdinStream)
+		if err != nil {
+			return nil, belError(err)
+		}
+		bit, err := s.ReadBit()
+		if err == io.EOF {
+			return Intern("eof"), nil
+		}
+		if err != nil {
+			return nil, belErrorf(OtherError, "rdb: %v", err)
+		}
+		return bitChar(bit), nil
+	}))
+
+	env.set("ops", primitive("ops", 2, func(args []Value) (Value, error) {
+		path, ok := goString(args[0])
+		if !ok {
+			return nil, belErrorf(TypeError, "ops: %s is not a string", toString(args[0]))
+		}
+		switch args[1] {
+		case Intern("in"):
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, belErrorf(OtherError, "ops: %v", err)
+			}
+			s := NewInStream(f)
+			s.closer = f
+			return s, nil
+		case Intern("out"):
+			f, err := os.Create(path)
+			if err != nil {
+				return nil, belErrorf(OtherError, "ops: %v", err)
+			}
+			s := NewOutStream(f)
+			s.closer = f
+			return s, nil
+		}
+		return nil, belErrorf(TypeError, "ops: %s is not in or out", toString(args[1]))
+	}))
+
+	env.set("cls", primitive("cls", 1, func(args []Value) (Value, error) {
+		s, ok := args[0].(*Stream)
+		if !ok {
+			return nil, belErrorf(TypeError, "cls: %s is not a stream", toString(args[0]))
+		}
+		if err := s.Close(); err != nil {
+			return nil, belErrorf(OtherError, "cls: %v", err)
+		}
+		return Intern("t"), nil
+	}))
+
+	env.set("stat", primitive("stat", 1, func(args []Value) (Value, error) {
+		s, ok := args[0].(*Stream)
+		if !ok {
+			return nil, belErrorf(TypeError, "stat: %s is not a stream", toString(args[0]))
+		}
+		return s.status(), nil
+	}))
+
+	// charbits is the list of bits a character is written as.
+	env.set("charbits", primitive("charbits", 1, func(args []Value) (Value, error) {
+		c, ok := args[0].(Char)
+		if !ok {
+			return nil, belErrorf(TypeError, "charbits: %s is not a character", toString(args[0]))
+		}
+		var bits []Value
+		buf := make([]byte, utf8.UTFMax)
+		for _, b := range buf[:utf8.EncodeRune(buf, rune(c))] {
+			for i := 7; i >= 0; i-- {
+				bits = append(bits, bitChar((b>>uint(i))&1))
+			}
+		}
+		return listOf(bits...), nil
+	}))
+
+	// bitschar is the character a list of bits encodes, or nil if more bits
+	// are needed to make up a character.
+	env.set("bitschar", primitive("bitschar", 1, func(args []Value) (Value, error) {
+		var buf []byte
+		var b byte
+		n := 0
+		l, ok := args[0].(*Pair)
+		for ; ok && l != Nil; l, ok = l.Rest.(*Pair) {
+			c, isChar := l.First.(Char)
+			if !isChar || (c != '0' && c != '1') {
+				return nil, belErrorf(TypeError, "bitschar: %s is not a bit", toString(l.First))
+			}
+			b = b<<1 | byte(c-'0')
+			if n++; n == 8 {
+				buf = append(buf, b)
+				b, n = 0, 0
+			}
+		}
+		if !ok {
+			return nil, belErrorf(TypeError, "bitschar: %s is not a list", toString(args[0]))
+		}
+		if n != 0 || !utf8.FullRune(buf) {
+			return Nil, nil
+		}
+		c, size := utf8.DecodeRune(buf)
+		if (c == utf8.RuneError && size <= 1) || size != len(buf) {
+			return nil, belErrorf(OtherError, "bitschar: bits are not a character")
+		}
+		return Char(c), nil
+	}))
+
+	// repr is the string x prints as.
+	env.set("repr", primitive("repr", 1, func(args []Value) (Value, error) {
+		return belString(toString(args[0])), nil
+	}))
+
+	// rdexpr reads an expression from a stream, for read to use.
+	env.set("rdexpr", primitive("rdexpr", 1, func(args []Value) (Value, error) {
+		s, err := streamArg("rdexpr", args[0], stdinStream)
+		if err != nil {
+			return nil, belError(err)
+		}
+		e, err := s.Reader().ReadExpr()
+		if err == io.EOF {
+			return Intern("eof"), nil
+		}
+		if err != nil {
+			return nil, belError(err)
+		}
+		return e, nil
+	}))
+}
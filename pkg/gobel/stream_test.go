@@ -0,0 +1,145 @@
+package gobel
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	t.Run("bits go most significant first", func(t *testing.T) {
+		var out bytes.Buffer
+		s := NewOutStream(&out)
+		for _, bit := range []byte{0, 1, 0, 0, 0, 0, 0, 1} {
+			if err := s.WriteBit(bit); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+		if out.String() != "A" {
+			t.Errorf("Expected A but got %q", out.String())
+		}
+
+		in := NewInStream(strings.NewReader("A"))
+		var bits []byte
+		for {
+			bit, err := in.ReadBit()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			bits = append(bits, bit)
+		}
+		if want := []byte{0, 1, 0, 0, 0, 0, 0, 1}; !reflect.DeepEqual(want, bits) {
+			t.Errorf("Expected %v but got %v", want, bits)
+		}
+	})
+
+	t.Run("nothing is written until a byte is finished", func(t *testing.T) {
+		var out bytes.Buffer
+		s := NewOutStream(&out)
+		s.WriteBit(1)
+		if out.Len() != 0 {
+			t.Errorf("Expected nothing to be written but got %q", out.String())
+		}
+	})
+
+	t.Run("writing characters", func(t *testing.T) {
+		cases := []struct {
+			name    string
+			program string
+			want    string
+		}{
+			{"wrb", `(map [wrb _ outs] "01100001")`, "a"},
+			{"prc", `(prc \a)`, "a"},
+			{"prc of a multi-byte character", `(prc \é)`, "é"},
+			{"print", `(print '(a "b" \c))`, `(a "b" \c)`},
+			{"prn", `(prn 1 'a)`, "1 a \n"},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				var out bytes.Buffer
+				env := GlobalEnv()
+				env.set("outs", NewOutStream(&out))
+				if _, err := Eval(Read(c.program), env); err != nil {
+					t.Fatalf("Unexpected error %v", err)
+				}
+				if out.String() != c.want {
+					t.Errorf("Expected %q but got %q", c.want, out.String())
+				}
+			})
+		}
+	})
+
+	t.Run("reading", func(t *testing.T) {
+		env := GlobalEnv()
+		env.set("ins", NewInStream(strings.NewReader("aé(b c)")))
+		cases := []evalCase{
+			{"rdb", Read("(list (rdb ins) (rdb ins))"), env, belString("01")},
+			{"rdb carries on where it left off", Read("(list (rdb ins) (rdb ins) (rdb ins) (rdb ins) (rdb ins) (rdb ins))"), env, belString("100001")},
+			{"rdc", Read("(rdc)"), env, Char('é')},
+			{"read", Read("(read)"), env, Read("(b c)")[0]},
+			{"read at the end", Read("(read)"), env, Intern("eof")},
+			{"rdb at the end", Read("(rdb ins)"), env, Intern("eof")},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("default streams", func(t *testing.T) {
+		stdin := NewInStream(strings.NewReader("(set x (read))\nhello\n(prn (list x))\n"))
+		var stdout bytes.Buffer
+		env := GlobalEnvWithStreams(stdin, NewOutStream(&stdout))
+		r := stdin.Reader()
+		for {
+			e, err := r.ReadExpr()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if _, err := Eval([]Value{e}, env); err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+		}
+		if got, want := stdout.String(), "(hello) \n"; got != want {
+			t.Errorf("Expected %q but got %q", want, got)
+		}
+	})
+
+	t.Run("files", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.txt")
+		env := GlobalEnv()
+		env.set("path", belString(path))
+		cases := []evalCase{
+			{"ops out", Read("(set s (ops path 'out)) (stat s)"), env, Intern("out")},
+			{"write", Read(`(prc \h s) (prc \i s) (cls s)`), env, Intern("t")},
+			{"closed", Read("(stat s)"), env, Intern("closed")},
+			{"ops in", Read("(set s (ops path 'in)) (stat s)"), env, Intern("in")},
+			{"read back", Read("(list (rdc s) (rdc s) (rdc s))"), env, listOf(Char('h'), Char('i'), Intern("eof"))},
+			{"type", Read("(type s)"), env, Intern("stream")},
+		}
+		testEvalCases(cases, t)
+		if _, err := Eval(Read("(cls s)"), env); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+
+		got, err := ioutil.ReadFile(path)
+		if err != nil || string(got) != "hi" {
+			t.Errorf("Expected the file to hold hi but got %q, %v", got, err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, program := range []string{"(wrb 'a)", "(wrb \\0 (ops \"stream_test.go\" 'in))", "(ops \"x\" 'sideways)", "(cls 'a)", "(bitschar '(\\2))"} {
+			if _, err := Eval(Read(program), GlobalEnv()); err == nil {
+				t.Errorf("Expected an error from %s", program)
+			}
+		}
+	})
+}
@@ -2,66 +2,157 @@ package gobel
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 	"unsafe"
 )
 
 func (p *Pair) String() string {
-	if p == Nil {
-		return "()"
-	}
+	pr := newPrinter(p)
+	pr.print(p)
+	return pr.s.String()
+}
+
+// printer writes out a graph of pairs and tables. Any pair or table that can be
+// reached more than once, whether because it is shared or because the graph has
+// a cycle in it, is labelled with #n= the first time it is printed and written
+// as #n# after that, the same way the reader reads them.
+type printer struct {
+	s      strings.Builder
+	shared map[Value]bool
+	labels map[Value]int
+}
 
-	var s strings.Builder
-	var actualString strings.Builder
-	isActualString := true
+func newPrinter(v Value) *printer {
+	pr := &printer{
+		shared: make(map[Value]bool),
+		labels: make(map[Value]int),
+	}
+	seen := make(map[Value]bool)
+	var visit func(v Value)
+	visit = func(v Value) {
+		if t, ok := v.(*Table); ok {
+			if seen[t] {
+				pr.shared[t] = true
+				return
+			}
+			seen[t] = true
+			for _, e := range t.entries {
+				visit(e.key)
+				visit(e.value)
+			}
+			return
+		}
+		for p, ok := v.(*Pair); ok && p != Nil; p, ok = p.Rest.(*Pair) {
+			if seen[p] {
+				pr.shared[p] = true
+				return
+			}
+			seen[p] = true
+			visit(p.First)
+		}
+	}
+	visit(v)
+	return pr
+}
 
-	s.WriteString("(")
-	actualString.WriteRune('"')
+func (pr *printer) print(v Value) {
+	if t, ok := v.(*Table); ok {
+		pr.printTable(t)
+		return
+	}
+	p, ok := v.(*Pair)
+	if !ok {
+		pr.s.WriteString(toString(v))
+		return
+	}
+	if p == Nil {
+		pr.s.WriteString("()")
+		return
+	}
+	if pr.label(p) {
+		return
+	}
 
-	for {
-		s.WriteString(toString(p.First))
-		if isActualString {
-			if r, ok := p.First.(rune); ok {
-				if r == '"' {
-					actualString.WriteRune('\\')
-				}
-				actualString.WriteRune(r)
-			} else {
-				isActualString = false
+	if pr.isString(p) {
+		pr.s.WriteRune('"')
+		for p != Nil {
+			r := rune(p.First.(Char))
+			if r == '"' || r == '\\' {
+				pr.s.WriteRune('\\')
 			}
+			pr.s.WriteRune(r)
+			p, _ = p.Rest.(*Pair)
 		}
+		pr.s.WriteRune('"')
+		return
+	}
 
+	pr.s.WriteString("(")
+	for {
+		pr.print(p.First)
 		if p.Rest == Nil || p.Rest == nil {
-			if isActualString {
-				actualString.WriteRune('"')
-				return actualString.String()
-			}
-			s.WriteString(")")
-			return s.String()
+			break
 		}
-		if next, ok := p.Rest.(*Pair); ok {
-			s.WriteString(" ")
-			p = next
-			continue
+		next, ok := p.Rest.(*Pair)
+		if !ok || pr.shared[next] {
+			pr.s.WriteString(" . ")
+			pr.print(p.Rest)
+			break
 		}
+		pr.s.WriteString(" ")
+		p = next
+	}
+	pr.s.WriteString(")")
+}
 
-		s.WriteString(" . ")
-		s.WriteString(toString(p.Rest))
-		s.WriteString(")")
-		isActualString = false
-		break
+// printTable writes t as #table followed by its entries as an association
+// list, which the reader reads back as a table.
+func (pr *printer) printTable(t *Table) {
+	if pr.label(t) {
+		return
 	}
+	pr.s.WriteString("#table")
+	pr.print(t.alist())
+}
 
-	if isActualString {
-		actualString.WriteRune('"')
-		return actualString.String()
+// label writes #n# and reports true if v has already been printed, and
+// otherwise writes #n= ahead of v if it needs a label.
+func (pr *printer) label(v Value) bool {
+	if n, ok := pr.labels[v]; ok {
+		fmt.Fprintf(&pr.s, "#%d#", n)
+		return true
+	}
+	if pr.shared[v] {
+		n := len(pr.labels) + 1
+		pr.labels[v] = n
+		fmt.Fprintf(&pr.s, "#%d=", n)
+	}
+	return false
+}
+
+// isString reports whether p is a proper list of characters, none of which
+// needs a label of its own after the first.
+func (pr *printer) isString(p *Pair) bool {
+	for {
+		if _, ok := p.First.(Char); !ok {
+			return false
+		}
+		next, ok := p.Rest.(*Pair)
+		if !ok {
+			return p.Rest == nil
+		}
+		if next == Nil {
+			return true
+		}
+		if pr.shared[next] {
+			return false
+		}
+		p = next
 	}
-	return s.String()
 }
 
 func (s Symbol) String() string {
-	return s.Str
+	return s.name
 }
 
 func (p *Procedure) String() string {
@@ -69,14 +160,13 @@ func (p *Procedure) String() string {
 	return fmt.Sprintf("#[proceedure %v]", unsafe.Pointer(p))
 }
 
-func toString(i interface{}) string {
-	if v, ok := i.(int); ok {
-		return strconv.Itoa(v)
-	}
+func (m *Macro) String() string {
+	return fmt.Sprintf("#[macro %v]", unsafe.Pointer(m))
+}
 
-	if v, ok := i.(rune); ok {
-		return fmt.Sprintf("\\%s", string(v))
+func toString(v Value) string {
+	if v == nil {
+		return "()"
 	}
-
-	return i.(fmt.Stringer).String()
+	return v.String()
 }
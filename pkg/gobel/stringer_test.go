@@ -9,24 +9,48 @@ import (
 func TestStringer(t *testing.T) {
 	t.Run("symbols", func(t *testing.T) {
 		t.Parallel()
-		s := &g.Symbol{"symbol"}
-		if s.String() != s.Str {
-			t.Errorf("Expected %q but got %q", s.String(), s.Str)
+		s := g.Intern("symbol")
+		if s.String() != s.Name() {
+			t.Errorf("Expected %q but got %q", s.String(), s.Name())
 		}
 	})
 
 	t.Run("characters", func(t *testing.T) {
 		t.Parallel()
-		s := &g.Pair{'a', 'b'}
+		s := &g.Pair{g.Char('a'), g.Char('b')}
 		want := `(\a . \b)`
 		if s.String() != want {
 			t.Errorf("Expected %q but got %q", want, s.String())
 		}
 	})
 
+	t.Run("named characters", func(t *testing.T) {
+		t.Parallel()
+		s := &g.Pair{g.Char(' '), &g.Pair{g.Char('\n'), &g.Pair{g.Char('\u00a0'), &g.Pair{g.Int(1), g.Nil}}}}
+		want := `(\sp \lf \u00a0 1)`
+		if s.String() != want {
+			t.Errorf("Expected %q but got %q", want, s.String())
+		}
+	})
+
+	t.Run("numbers", func(t *testing.T) {
+		for _, n := range []string{"1", "-1", "123456789012345678901234567890", "-3/4", "1/123456789012345678901234567890"} {
+			t.Run(n, func(t *testing.T) {
+				got := (&g.Pair{g.Read(n)[0], &g.Pair{g.Int(1), g.Nil}}).String()
+				if want := "(" + n + " 1)"; got != want {
+					t.Errorf("Expected %q but got %q", want, got)
+				}
+			})
+		}
+	})
+
 	t.Run("proceedure", func(t *testing.T) {
 		t.Parallel()
-		p := g.Eval(g.Read("(lambda (x) x)"), g.GlobalEnv()).(*g.Procedure)
+		v, err := g.Eval(g.Read("(lambda (x) x)"), g.GlobalEnv())
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		p := v.(*g.Procedure)
 		if !strings.HasPrefix(p.String(), "#[proceedure") {
 			t.Errorf("Not how I want proceedures to print - %v!", p.String())
 		}
@@ -40,12 +64,12 @@ func TestStringer(t *testing.T) {
 		}{
 			{"nil", nil, "()"},
 			{"Nil", g.Nil, "()"},
-			{"simple pair", &g.Pair{1, 2}, "(1 . 2)"},
-			{"simple proper list", &g.Pair{1, g.Nil}, "(1)"},
-			{"two item proper list", &g.Pair{1, &g.Pair{2, g.Nil}}, "(1 2)"},
+			{"simple pair", &g.Pair{g.Int(1), g.Int(2)}, "(1 . 2)"},
+			{"simple proper list", &g.Pair{g.Int(1), g.Nil}, "(1)"},
+			{"two item proper list", &g.Pair{g.Int(1), &g.Pair{g.Int(2), g.Nil}}, "(1 2)"},
 			{"three item proper list", g.Read("(1 2 3)")[0].(*g.Pair), "(1 2 3)"},
 			{"nested lists", g.Read("((1) (2 (3)))")[0].(*g.Pair), "((1) (2 (3)))"},
-			{"dotted list", &g.Pair{1, &g.Pair{2, 3}}, "(1 2 . 3)"},
+			{"dotted list", &g.Pair{g.Int(1), &g.Pair{g.Int(2), g.Int(3)}}, "(1 2 . 3)"},
 		}
 
 		for _, c := range cases {
@@ -57,13 +81,49 @@ func TestStringer(t *testing.T) {
 		}
 	})
 
+	t.Run("shared and circular structure", func(t *testing.T) {
+		circular := &g.Pair{g.Int(1), g.Nil}
+		circular.Rest = &g.Pair{g.Int(2), circular}
+		containsItself := &g.Pair{g.Int(1), g.Nil}
+		containsItself.First = containsItself
+		shared := &g.Pair{g.Int(1), g.Nil}
+		sharedString := g.Read(`"ab"`)[0]
+		sharedTail := g.Read("(2 3)")[0]
+
+		cases := []struct {
+			name     string
+			list     *g.Pair
+			stringed string
+		}{
+			{"circular list", circular, "#1=(1 2 . #1#)"},
+			{"list containing itself", containsItself, "#1=(#1#)"},
+			{"shared list", &g.Pair{shared, &g.Pair{shared, g.Nil}}, "(#1=(1) #1#)"},
+			{"shared string", &g.Pair{sharedString, &g.Pair{sharedString, g.Nil}}, `(#1="ab" #1#)`},
+			{"shared tail", &g.Pair{&g.Pair{g.Int(1), sharedTail}, &g.Pair{sharedTail, g.Nil}}, "((1 . #1=(2 3)) #1#)"},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				got := c.list.String()
+				if got != c.stringed {
+					t.Errorf("Expected %q but got %q", c.stringed, got)
+				}
+				again := g.Read(got)[0].(*g.Pair).String()
+				if again != got {
+					t.Errorf("Expected %q to read back and print the same but got %q", got, again)
+				}
+			})
+		}
+	})
+
 	t.Run("strings", func(t *testing.T) {
 		cases := []struct {
 			want string
 			str  *g.Pair
 		}{
-			{`"abc"`, &g.Pair{'a', &g.Pair{'b', &g.Pair{'c', g.Nil}}}},
-			{`"\"a\""`, &g.Pair{'"', &g.Pair{'a', &g.Pair{'"', g.Nil}}}},
+			{`"abc"`, &g.Pair{g.Char('a'), &g.Pair{g.Char('b'), &g.Pair{g.Char('c'), g.Nil}}}},
+			{`"\"a\""`, &g.Pair{g.Char('"'), &g.Pair{g.Char('a'), &g.Pair{g.Char('"'), g.Nil}}}},
+			{`"a\\b"`, &g.Pair{g.Char('a'), &g.Pair{g.Char('\\'), &g.Pair{g.Char('b'), g.Nil}}}},
 		}
 
 		for _, c := range cases {
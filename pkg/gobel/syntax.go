@@ -0,0 +1,201 @@
+package gobel
+
+import (
+	"strings"
+	"text/scanner"
+)
+
+// SyntaxKind says what sort of thing a Syntax node is.
+type SyntaxKind int
+
+const (
+	// SyntaxFile is the root of a tree, holding everything in a source file.
+	SyntaxFile SyntaxKind = iota
+	// SyntaxList is a list in round or square brackets.
+	SyntaxList
+	// SyntaxAtom is a symbol, number, character or label reference.
+	SyntaxAtom
+	// SyntaxString is a string in double quotes.
+	SyntaxString
+	// SyntaxPrefix is a quote, backquote, comma, comma-at, datum comment or
+	// label, and the expression it applies to.
+	SyntaxPrefix
+	// SyntaxComment is a line comment or a block comment.
+	SyntaxComment
+)
+
+// Syntax is a node in a concrete syntax tree for Bel source. Unlike the values
+// Read returns, it keeps everything about how the source was written: the
+// comments, the whitespace and the exact spelling of each token. Printing the
+// tree with String gives back the source it was parsed from.
+type Syntax struct {
+	Kind SyntaxKind
+	Pos  scanner.Position
+	// Space is the whitespace between the previous node and this one.
+	Space string
+	// Text is the token itself for atoms, strings and comments, the prefix for
+	// prefixes and the opening bracket for lists.
+	Text     string
+	Children []*Syntax
+	// EndSpace is the whitespace after the last child of a list or file.
+	EndSpace string
+	// Close is the closing bracket of a list.
+	Close string
+}
+
+func (s *Syntax) String() string {
+	var b strings.Builder
+	s.write(&b)
+	return b.String()
+}
+
+func (s *Syntax) write(b *strings.Builder) {
+	b.WriteString(s.Space)
+	b.WriteString(s.Text)
+	for _, c := range s.Children {
+		c.write(b)
+	}
+	b.WriteString(s.EndSpace)
+	b.WriteString(s.Close)
+}
+
+// IsLineComment reports whether s is a comment that runs to the end of the line.
+func (s *Syntax) IsLineComment() bool {
+	return s.Kind == SyntaxComment && strings.HasPrefix(s.Text, ";")
+}
+
+// ParseSyntax parses a whole Bel source file into a concrete syntax tree. It
+// only accepts source that Read accepts, so that nothing built from the tree,
+// such as the output of Format, can mean something different from what was
+// written. It splits the source into tokens with a BelLexer, just as Read does.
+// Errors are a *ParseError.
+func ParseSyntax(filename, src string) (*Syntax, error) {
+	if _, err := Parse(filename, src); err != nil {
+		return nil, err
+	}
+	toks := NewBelLexer(strings.NewReader(src))
+	toks.Comments = true
+	p := &syntaxParser{filename: filename, src: src, toks: toks}
+	file := &Syntax{Kind: SyntaxFile, Pos: scanner.Position{Filename: filename, Line: 1, Column: 1}}
+	for {
+		space := p.space()
+		if toks.End() {
+			file.EndSpace = space
+			return file, nil
+		}
+		n, err := p.node(space)
+		if err != nil {
+			return nil, err
+		}
+		file.Children = append(file.Children, n)
+	}
+}
+
+// syntaxParser builds a syntax tree out of the tokens of src. The whitespace
+// between tokens is found from where they are in src.
+type syntaxParser struct {
+	filename string
+	src      string
+	toks     *BelLexer
+	// end is the offset of the end of the last token read.
+	end int
+}
+
+// closers are the brackets that close each opening bracket.
+var closers = map[string]string{"(": ")", "[": "]", "{": "}"}
+
+// space is the whitespace between the last token and the next one.
+func (p *syntaxParser) space() string {
+	return p.src[p.end:p.toks.Pos().Offset]
+}
+
+// next reads the current token and moves on to the next one. The token's text
+// is taken from src, so that it is exactly as written.
+func (p *syntaxParser) next() (Token, error) {
+	tok := p.toks.Token()
+	tok.Pos.Filename = p.filename
+	if err := p.toks.Err(); err != nil {
+		return tok, &ParseError{Pos: tok.Pos, Token: tok.Text, Msg: err.Error()}
+	}
+	// until the lexer moves on, its position is the end of the current token
+	p.end = p.toks.pos.Offset
+	tok.Text = p.src[tok.Pos.Offset:p.end]
+	p.toks.Next()
+	return tok, nil
+}
+
+func (p *syntaxParser) errorAt(tok Token, msg string) *ParseError {
+	return &ParseError{Pos: tok.Pos, Token: tok.Text, Msg: msg}
+}
+
+func (p *syntaxParser) node(space string) (*Syntax, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	n := &Syntax{Space: space, Pos: tok.Pos, Text: tok.Text}
+	switch tok.Kind {
+	case TokenOpen:
+		n.Kind = SyntaxList
+		closer := closers[tok.Text]
+		for {
+			space := p.space()
+			if p.toks.End() {
+				return nil, p.errorAt(p.toks.Token(), "unexpected end of input, expected "+closer)
+			}
+			if p.toks.Token().Kind == TokenClose {
+				c, err := p.next()
+				if err != nil {
+					return nil, err
+				}
+				if c.Text != closer {
+					return nil, p.errorAt(c, "expected "+closer)
+				}
+				n.EndSpace = space
+				n.Close = closer
+				return n, nil
+			}
+			child, err := p.node(space)
+			if err != nil {
+				return nil, err
+			}
+			n.Children = append(n.Children, child)
+		}
+	case TokenClose:
+		return nil, p.errorAt(tok, "unexpected "+tok.Text)
+	case TokenPrefix:
+		return p.prefix(n)
+	case TokenLabel:
+		if strings.HasSuffix(tok.Text, "=") {
+			return p.prefix(n)
+		}
+		n.Kind = SyntaxAtom
+	case TokenString:
+		n.Kind = SyntaxString
+	case TokenComment:
+		n.Kind = SyntaxComment
+	default:
+		n.Kind = SyntaxAtom
+	}
+	return n, nil
+}
+
+// prefix reads the expression a prefix applies to, along with any comments in
+// between.
+func (p *syntaxParser) prefix(n *Syntax) (*Syntax, error) {
+	n.Kind = SyntaxPrefix
+	for {
+		space := p.space()
+		if p.toks.End() {
+			return nil, p.errorAt(p.toks.Token(), "unexpected end of input")
+		}
+		child, err := p.node(space)
+		if err != nil {
+			return nil, err
+		}
+		n.Children = append(n.Children, child)
+		if child.Kind != SyntaxComment {
+			return n, nil
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package gobel
+
+import (
+	"testing"
+)
+
+func TestParseSyntax(t *testing.T) {
+	t.Run("lossless", func(t *testing.T) {
+		cases := []string{
+			"",
+			"  \n",
+			"(+ 1 2)",
+			"  (a   b\n\n  c )  \n",
+			"; comment\n(a) ; another\n",
+			"#| block #| nested |# |# a",
+			"'a `(b ,c ,@d) #;(e) f",
+			"#1=(a . #1#)",
+			`"a \"string\"" \a \sp \( \"`,
+			"[f _ x]",
+			"(a.b x|int ~f:g)",
+			"(quote ; why\n a)",
+			"(a \xff b)",
+			"#table((a . 1))",
+		}
+		for _, c := range cases {
+			tree, err := ParseSyntax("test.bel", c)
+			if err != nil {
+				t.Fatalf("Unexpected error parsing %q: %v", c, err)
+			}
+			if got := tree.String(); got != c {
+				t.Errorf("Expected %q to print back the same but got %q", c, got)
+			}
+		}
+	})
+
+	t.Run("structure", func(t *testing.T) {
+		tree, err := ParseSyntax("test.bel", "; hi\n(a 'b \"c\")")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if len(tree.Children) != 2 || !tree.Children[0].IsLineComment() {
+			t.Fatalf("Expected a comment and a list but got %#v", tree.Children)
+		}
+		list := tree.Children[1]
+		kinds := []SyntaxKind{SyntaxAtom, SyntaxPrefix, SyntaxString}
+		if list.Kind != SyntaxList || len(list.Children) != len(kinds) {
+			t.Fatalf("Expected a list of three things but got %#v", list)
+		}
+		for i, k := range kinds {
+			if list.Children[i].Kind != k {
+				t.Errorf("Expected child %d to be kind %d but got %d", i, k, list.Children[i].Kind)
+			}
+		}
+		if list.Pos.Line != 2 || list.Pos.Column != 1 {
+			t.Errorf("Expected the list at 2:1 but got %s", list.Pos)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []string{"(a", "a)", "(a]", `"a`, "#| a", "'", `(a \*b)`, "(a {b c})", "(. a)", "#12"}
+		for _, c := range cases {
+			if _, err := ParseSyntax("test.bel", c); err == nil {
+				t.Errorf("Expected an error parsing %q", c)
+			} else if _, ok := err.(*ParseError); !ok {
+				t.Errorf("Expected a *ParseError parsing %q but got %#v", c, err)
+			}
+		}
+	})
+}
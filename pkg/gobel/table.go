@@ -0,0 +1,275 @@
+package gobel
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Table is a mutable key/value table. Keys are compared with Equal, so two
+// lists or strings with the same elements are the same key. Entries are kept
+// in the order they were added, which is the order Range, keys and vals give
+// them in and the order a table prints in.
+//
+// Applying a table to a key looks it up, so (tab 'k) is the value for k, and
+// (set (tab 'k) v) updates it. Setting a key to nil removes it, as a table
+// can't tell a key with a nil value from one that isn't there.
+type Table struct {
+	// buckets holds the positions in entries of the keys with each hash.
+	buckets map[uint64][]int
+	entries []tableEntry
+}
+
+type tableEntry struct {
+	key, value Value
+}
+
+func NewTable() *Table {
+	return &Table{buckets: make(map[uint64][]int)}
+}
+
+// find returns the hash of k and its position in t.entries, or -1 if it isn't
+// there.
+func (t *Table) find(k Value) (uint64, int) {
+	h := Hash(k)
+	for _, i := range t.buckets[h] {
+		if Equal(t.entries[i].key, k) {
+			return h, i
+		}
+	}
+	return h, -1
+}
+
+// Get returns the value stored under k, and whether there is one.
+func (t *Table) Get(k Value) (Value, bool) {
+	if _, i := t.find(k); i != -1 {
+		return t.entries[i].value, true
+	}
+	return Nil, false
+}
+
+// Set stores v under k, or removes k if v is nil.
+func (t *Table) Set(k, v Value) {
+	if isNil(v) {
+		t.Delete(k)
+		return
+	}
+	h, i := t.find(k)
+	if i != -1 {
+		t.entries[i].value = v
+		return
+	}
+	t.buckets[h] = append(t.buckets[h], len(t.entries))
+	t.entries = append(t.entries, tableEntry{k, v})
+}
+
+// Delete removes k from t. The entries after it move down one place, so their
+// positions in buckets move with them.
+func (t *Table) Delete(k Value) {
+	h, i := t.find(k)
+	if i == -1 {
+		return
+	}
+	bucket := t.buckets[h]
+	for j, n := range bucket {
+		if n == i {
+			bucket = append(bucket[:j], bucket[j+1:]...)
+			break
+		}
+	}
+	if len(bucket) == 0 {
+		delete(t.buckets, h)
+	} else {
+		t.buckets[h] = bucket
+	}
+	t.entries = append(t.entries[:i], t.entries[i+1:]...)
+	for _, b := range t.buckets {
+		for j, n := range b {
+			if n > i {
+				b[j] = n - 1
+			}
+		}
+	}
+}
+
+func (t *Table) Len() int {
+	return len(t.entries)
+}
+
+// Range calls fn on each entry in turn, stopping early if fn returns false.
+func (t *Table) Range(fn func(k, v Value) bool) {
+	for _, e := range t.entries {
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// alist returns the entries of t as an association list.
+func (t *Table) alist() *Pair {
+	items := make([]Value, len(t.entries))
+	for i, e := range t.entries {
+		items[i] = cons(e.key, e.value)
+	}
+	return listOf(items...)
+}
+
+// String writes t as #table followed by its entries as an association list,
+// which the reader reads back as a table. Tables and pairs that are reached
+// more than once are labelled, as they are in lists.
+func (t *Table) String() string {
+	pr := newPrinter(t)
+	pr.print(t)
+	return pr.s.String()
+}
+
+// tableFromAlist makes a table out of an association list.
+func tableFromAlist(kvs Value) (*Table, error) {
+	t := NewTable()
+	l, ok := kvs.(*Pair)
+	for ; ok && l != Nil; l, ok = l.Rest.(*Pair) {
+		kv, isPair := l.First.(*Pair)
+		if !isPair || kv == Nil {
+			return nil, fmt.Errorf("%s is not a key/value pair", toString(l.First))
+		}
+		t.Set(kv.First, kv.Rest)
+	}
+	if !ok {
+		return nil, errors.New("a table needs a list of key/value pairs")
+	}
+	return t, nil
+}
+
+// readTable reads #table((k . v) ...).
+func readTable(r *Reader, toks Lexer) (Value, error) {
+	toks.Next()
+	kvs, err := r.ReadDatum()
+	if err != nil {
+		return nil, err
+	}
+	return tableFromAlist(kvs)
+}
+
+// applyTable looks a key up in a table: (tab k) is the value stored under k,
+// or nil, and (tab k d) is d if there's nothing stored under k.
+func applyTable(t *Table, args *Pair) (Value, error) {
+	if args == Nil {
+		return nil, belErrorf(ArityError, "a table needs a key to look up")
+	}
+	if v, ok := t.Get(args.First); ok {
+		return v, nil
+	}
+	return cadr(args), nil
+}
+
+// setPlace assigns to the place described by an expression like (tab k),
+// whose parts are evaluated on machines inside m.
+func setPlace(m *machine, place *Pair, value Value, env *Env) (Value, error) {
+	v, err := eval(m, place.First, env)
+	if err != nil {
+		return nil, err
+	}
+	t, ok := v.(*Table)
+	if !ok {
+		return nil, belErrorf(TypeError, "cannot assign to %s", toString(place))
+	}
+	k, err := eval(m, cadr(place), env)
+	if err != nil {
+		return nil, err
+	}
+	t.Set(k, value)
+	return value, nil
+}
+
+// defineTables binds the functions that work on tables in env.
+func defineTables(env *Env) {
+	env.set("table", primitive("table", 1, func(args []Value) (Value, error) {
+		t, err := tableFromAlist(args[0])
+		if err != nil {
+			return nil, belError(err)
+		}
+		return t, nil
+	}))
+
+	// get returns the entry for k as a pair (k . v), as Bel's get does on
+	// association lists.
+	env.set("get", primitive("get", 2, func(args []Value) (Value, error) {
+		t, ok := args[1].(*Table)
+		if !ok {
+			return nil, belErrorf(TypeError, "get: %s is not a table", toString(args[1]))
+		}
+		if v, ok := t.Get(args[0]); ok {
+			return cons(args[0], v), nil
+		}
+		return Nil, nil
+	}))
+
+	env.set("keys", tableFunction("keys", func(t *Table) Value {
+		var keys []Value
+		t.Range(func(k, _ Value) bool {
+			keys = append(keys, k)
+			return true
+		})
+		return listOf(keys...)
+	}))
+
+	env.set("vals", tableFunction("vals", func(t *Table) Value {
+		var vals []Value
+		t.Range(func(_, v Value) bool {
+			vals = append(vals, v)
+			return true
+		})
+		return listOf(vals...)
+	}))
+
+	env.set("tablist", tableFunction("tablist", func(t *Table) Value {
+		return t.alist()
+	}))
+
+	// maptable calls f on each key and value in turn, and returns the table.
+	// The calls are made on the machine like any others, so that f can call
+	// continuations and signal errors.
+	env.set("maptable", &NativeProcedure{step: func(m *machine, l *Pair) error {
+		args, err := fixedArgs("maptable", 2, l)
+		if err != nil {
+			return err
+		}
+		t, ok := args[1].(*Table)
+		if !ok {
+			return belErrorf(TypeError, "maptable: %s is not a table", toString(args[1]))
+		}
+		// the entries are copied first, so that f can change the table
+		return maptable(m, args[0], t, append([]tableEntry(nil), t.entries...))
+	}})
+}
+
+// maptable calls f on the first of entries, and then on the rest.
+func maptable(m *machine, f Value, t *Table, entries []tableEntry) error {
+	if len(entries) == 0 {
+		m.ret(t)
+		return nil
+	}
+	m.push(&maptableFrame{f: f, t: t, rest: entries[1:]})
+	return m.apply(f, listOf(entries[0].key, entries[0].value))
+}
+
+// maptableFrame waits for f to return before calling it on the rest of the
+// entries.
+type maptableFrame struct {
+	f    Value
+	t    *Table
+	rest []tableEntry
+}
+
+func (f *maptableFrame) resume(m *machine, _ Value) error {
+	return maptable(m, f.f, f.t, f.rest)
+}
+
+func tableFunction(name string, fn func(*Table) Value) *NativeProcedure {
+	return primitive(name, 1, func(args []Value) (Value, error) {
+		t, ok := args[0].(*Table)
+		if !ok {
+			return nil, belErrorf(TypeError, "%s: %s is not a table", name, toString(args[0]))
+		}
+		return fn(t), nil
+	})
+}
@@ -0,0 +1,120 @@
+package gobel
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTable(t *testing.T) {
+	t.Run("lookup", func(t *testing.T) {
+		cases := []evalCase{
+			{"empty table", Read("((table) 'a)"), GlobalEnv(), Nil},
+			{"from an alist", Read("((table '((a . 1) (b . 2))) 'b)"), GlobalEnv(), Int(2)},
+			{"default", Read("((table) 'a 5)"), GlobalEnv(), Int(5)},
+			{"set", Read("(set tab (table)) (set (tab 'a) 1) (tab 'a)"), GlobalEnv(), Int(1)},
+			{"set returns the value", Read("(set tab (table)) (set (tab 'a) 1)"), GlobalEnv(), Int(1)},
+			{"set again", Read("(set tab (table)) (set (tab 'a) 1) (set (tab 'a) 2) (tab 'a)"), GlobalEnv(), Int(2)},
+			{"set to nil removes", Read("(set tab (table)) (set (tab 'a) 1) (set (tab 'a) nil) (keys tab)"), GlobalEnv(), Nil},
+			{"number keys", Read("(set tab (table)) (set (tab 1) 'a) (tab 1)"), GlobalEnv(), Intern("a")},
+			{"big number keys", Read("(set tab (table)) (set (tab 100000000000000000000) 'a) (tab 100000000000000000000)"), GlobalEnv(), Intern("a")},
+			{"char keys", Read(`(set tab (table)) (set (tab \a) 'a) (tab \a)`), GlobalEnv(), Intern("a")},
+			{"get", Read("(get 'a (table '((a . 1))))"), GlobalEnv(), &Pair{Intern("a"), Int(1)}},
+			{"get missing key", Read("(get 'b (table '((a . 1))))"), GlobalEnv(), Nil},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("iteration", func(t *testing.T) {
+		tab := "(set tab (table '((a . 1) (b . 2) (c . 3)))) (set (tab 'b) nil) (set (tab 'd) 4) "
+		cases := []evalCase{
+			{"keys", Read(tab + "(keys tab)"), GlobalEnv(), Read("(a c d)")[0]},
+			{"vals", Read(tab + "(vals tab)"), GlobalEnv(), Read("(1 3 4)")[0]},
+			{"tablist", Read(tab + "(tablist tab)"), GlobalEnv(), Read("((a . 1) (c . 3) (d . 4))")[0]},
+			{"maptable", Read(tab + "(set n 0) (maptable (fn (k v) (set n (+ n v))) tab) n"), GlobalEnv(), Int(8)},
+		}
+		testEvalCases(cases, t)
+	})
+
+	t.Run("delete keeps the other entries", func(t *testing.T) {
+		tab := NewTable()
+		for i := 0; i < 10; i++ {
+			tab.Set(Int(i), Int(i*i))
+		}
+		for _, k := range []Value{Int(0), Int(4), Int(9), Int(4)} {
+			tab.Delete(k)
+		}
+		var keys []Value
+		tab.Range(func(k, v Value) bool {
+			keys = append(keys, k)
+			if got, _ := tab.Get(k); got != v {
+				t.Errorf("Expected %s to be %s but got %s", k, v, got)
+			}
+			return true
+		})
+		if want := []Value{Int(1), Int(2), Int(3), Int(5), Int(6), Int(7), Int(8)}; !reflect.DeepEqual(keys, want) {
+			t.Errorf("Expected the keys %v but got %v", want, keys)
+		}
+		tab.Set(Int(4), Int(16))
+		if got, _ := tab.Get(Int(4)); got != Int(16) || tab.Len() != 8 {
+			t.Errorf("Expected to add 4 back but got %s in %s", got, tab)
+		}
+	})
+
+	t.Run("type", func(t *testing.T) {
+		testEvalCases([]evalCase{{"table", Read("(type (table))"), GlobalEnv(), Intern("table")}}, t)
+	})
+
+	t.Run("prints and reads back", func(t *testing.T) {
+		v, err := Eval(Read("(table '((a . 1) (b . (x y))))"), GlobalEnv())
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		tab := v.(*Table)
+		if got, want := tab.String(), "#table((a . 1) (b x y))"; got != want {
+			t.Errorf("Expected %s but got %s", want, got)
+		}
+		read, ok := Read(tab.String())[0].(*Table)
+		if !ok {
+			t.Fatalf("Expected to read a table back from %s", tab)
+		}
+		if !reflect.DeepEqual(tab.alist(), read.alist()) {
+			t.Errorf("Expected %s but read %s", tab, read)
+		}
+		if got := NewTable().String(); got != "#table()" {
+			t.Errorf("Expected an empty table to print as #table() but got %s", got)
+		}
+	})
+
+	t.Run("prints and reads back a table that contains itself", func(t *testing.T) {
+		v, err := Eval(Read("(let x (table) (set (x 'a) x) x)"), GlobalEnv())
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		tab := v.(*Table)
+		if got, want := tab.String(), "#1=#table((a . #1#))"; got != want {
+			t.Errorf("Expected %s but got %s", want, got)
+		}
+		read, ok := Read(tab.String())[0].(*Table)
+		if !ok {
+			t.Fatalf("Expected to read a table back from %s", tab)
+		}
+		if v, _ := read.Get(Intern("a")); v != read {
+			t.Errorf("Expected the table read back to contain itself but got %s", v)
+		}
+		list, err := Eval(Read("(let x (table) (set (x 'a) (list x)) (x 'a))"), GlobalEnv())
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if got, want := list.String(), "#1=(#table((a . #1#)))"; got != want {
+			t.Errorf("Expected %s but got %s", want, got)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, program := range []string{"(keys 'a)", "(get 'a '((a . 1)))", "(table '(a))", "(set (car x) 1)"} {
+			if _, err := Eval(Read(program), GlobalEnv()); err == nil {
+				t.Errorf("Expected an error from %s", program)
+			}
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package gobel
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// Value is any datum the reader can produce or the evaluator can work on. The
+// interface is sealed: the only values are the types in this package, which
+// are
+//
+//   - *Pair, which makes up lists and strings, and whose nil is Nil
+//   - *Symbol
+//   - Char
+//   - Int, *BigInt and *Rat, the numbers
+//   - *Procedure, *NativeProcedure, *SpecialForm and *Macro
+//   - *Continuation
+//   - *Table and *Stream
+//   - *BelError
+type Value interface {
+	// Type is the type of the value, as Bel's type primitive gives it.
+	Type() *Symbol
+	String() string
+	isValue()
+}
+
+// Char is a Bel character.
+type Char rune
+
+// Int is an integer small enough to fit in a Go int. Bigger integers are a
+// *BigInt.
+type Int int
+
+// BigInt is an integer too big for an Int.
+type BigInt big.Int
+
+// Rat is a fraction.
+type Rat big.Rat
+
+func (n *BigInt) big() *big.Int { return (*big.Int)(n) }
+
+func (r *Rat) big() *big.Rat { return (*big.Rat)(r) }
+
+// ErrorKind says what sort of failure a *BelError is.
+type ErrorKind int
+
+const (
+	// OtherError is any failure that isn't one of the kinds below, such as
+	// dividing by zero or a file that can't be opened.
+	OtherError ErrorKind = iota
+	// UnboundError is a reference to a variable that has no value.
+	UnboundError
+	// ArityError is a call with too many or too few arguments.
+	ArityError
+	// TypeError is an argument of the wrong type, such as the car of an atom.
+	TypeError
+	// NotCallableError is a call to something that isn't a function.
+	NotCallableError
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case UnboundError:
+		return "unbound"
+	case ArityError:
+		return "arity"
+	case TypeError:
+		return "type"
+	case NotCallableError:
+		return "not-callable"
+	}
+	return "error"
+}
+
+// BelError is an error raised while evaluating Bel. Evaluation stops as soon
+// as one happens, and it's returned from Eval.
+type BelError struct {
+	Kind ErrorKind
+	Msg  string
+	// Stack is the calls that were being evaluated when the error happened,
+	// innermost first.
+	Stack []Value
+}
+
+func (e *BelError) Error() string {
+	return e.Msg
+}
+
+// StackTrace is the error followed by the calls on its stack, one to a line.
+// The error starts with its kind, unless it's an OtherError.
+func (e *BelError) StackTrace() string {
+	var s strings.Builder
+	if e.Kind != OtherError {
+		fmt.Fprintf(&s, "%s ", e.Kind)
+	}
+	fmt.Fprintf(&s, "error: %s", e.Msg)
+	for _, call := range e.Stack {
+		s.WriteString("\n  in ")
+		s.WriteString(toString(call))
+	}
+	return s.String()
+}
+
+func belErrorf(kind ErrorKind, format string, args ...interface{}) *BelError {
+	return &BelError{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// belError turns a Go error into a *BelError.
+func belError(err error) *BelError {
+	if e, ok := err.(*BelError); ok {
+		return e
+	}
+	return &BelError{Kind: OtherError, Msg: err.Error()}
+}
+
+func (*Pair) isValue()            {}
+func (*Symbol) isValue()          {}
+func (Char) isValue()             {}
+func (Int) isValue()              {}
+func (*BigInt) isValue()          {}
+func (*Rat) isValue()             {}
+func (*Procedure) isValue()       {}
+func (*NativeProcedure) isValue() {}
+func (*SpecialForm) isValue()     {}
+func (*Macro) isValue()           {}
+func (*Table) isValue()           {}
+func (*Stream) isValue()          {}
+func (*BelError) isValue()        {}
+
+func (p *Pair) Type() *Symbol {
+	if p == Nil {
+		return Intern("symbol")
+	}
+	return Intern("pair")
+}
+
+func (*Symbol) Type() *Symbol          { return Intern("symbol") }
+func (Char) Type() *Symbol             { return Intern("char") }
+func (Int) Type() *Symbol              { return Intern("number") }
+func (*BigInt) Type() *Symbol          { return Intern("number") }
+func (*Rat) Type() *Symbol             { return Intern("number") }
+func (*Procedure) Type() *Symbol       { return Intern("fn") }
+func (*NativeProcedure) Type() *Symbol { return Intern("fn") }
+func (*SpecialForm) Type() *Symbol     { return Intern("form") }
+func (*Macro) Type() *Symbol           { return Intern("mac") }
+func (*Table) Type() *Symbol           { return Intern("table") }
+func (*Stream) Type() *Symbol          { return Intern("stream") }
+func (*BelError) Type() *Symbol        { return Intern("err") }
+
+func (c Char) String() string {
+	return charString(rune(c))
+}
+
+func (n Int) String() string {
+	return strconv.Itoa(int(n))
+}
+
+func (n *BigInt) String() string {
+	return n.big().String()
+}
+
+func (r *Rat) String() string {
+	return r.big().RatString()
+}
+
+func (p *NativeProcedure) String() string {
+	return fmt.Sprintf("#[native %v]", unsafe.Pointer(p))
+}
+
+func (f *SpecialForm) String() string {
+	return fmt.Sprintf("#[special form %v]", unsafe.Pointer(f))
+}
+
+func (e *BelError) String() string {
+	return "#[error " + e.Msg + "]"
+}